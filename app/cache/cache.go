@@ -0,0 +1,425 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxTTL         = 24 * time.Hour
+	defaultMaxNegativeTTL = 3 * time.Hour
+
+	// defaultStaleAnswerTTL is the TTL of stale records, as recommended by RFC 8767 section 4.
+	defaultStaleAnswerTTL = 30 * time.Second
+
+	// refreshBackoff is how long to wait before refreshing an entry again after a refresh started.
+	refreshBackoff = 30 * time.Second
+)
+
+// Status tells how a lookup was answered.
+type Status int
+
+const (
+	// Miss means the cache holds no usable response.
+	Miss Status = iota
+
+	// Fresh means the cached response is still within its TTL.
+	Fresh
+
+	// Stale means the cached response expired but is still within the stale window.
+	Stale
+)
+
+// Result is the outcome of a cache lookup.
+//
+// Fields:
+//
+// - Response: The cached response for Fresh and Stale lookups, see Lookup.
+//
+// - Status: Whether the response is fresh, stale or missing.
+//
+// - Refresh: Set when the caller should resolve the question again in the background and store the
+// new response with Set. The cache asks for a refresh of stale entries and of popular entries close
+// to expiry, and only asks one caller at a time.
+type Result struct {
+	Response *dns.Message
+	Status   Status
+	Refresh  bool
+}
+
+// Key identifies the cached response to a question.
+type Key struct {
+	Name  string
+	Type  dns.Type
+	Class dns.Class
+}
+
+// KeyOf returns the cache key of a question. Names are compared case-insensitively.
+func KeyOf(question dns.Question) Key {
+	return Key{
+		Name:  dns.CanonicalName(question.Name),
+		Type:  question.Type,
+		Class: question.Class,
+	}
+}
+
+// Stats holds the counters of a Cache. Stale counts the hits that were answered with stale data.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Stale  uint64
+	Size   int
+}
+
+// entry is a cached response together with the time it was stored and how long it stays valid.
+type entry struct {
+	key            Key
+	response       *dns.Message
+	stored         time.Time
+	ttl            time.Duration
+	hits           int
+	refreshStarted time.Time
+}
+
+// Cache is an in-memory cache of DNS responses keyed by (name, type, class).
+// It holds at most Capacity entries and evicts the least recently used one when full.
+//
+// Positive responses live as long as the smallest TTL of their records. Negative responses,
+// NXDOMAIN and NODATA, live as long as the SOA record of their authority section allows
+// as described in RFC 2308; negative responses without a SOA are not cached.
+// Responses served from the cache carry TTLs decremented by the time they spent in the cache.
+//
+// Expired responses may still be served for StaleWindow as described in RFC 8767, while the caller
+// refreshes them in the background. Responses asked for at least PrefetchHits times are refreshed
+// early once they are within PrefetchWindow of expiring.
+//
+// Fields:
+//
+// - Capacity: The maximum number of cached responses.
+//
+// - MinTTL: The shortest time a response is cached, even if its records carry a smaller TTL.
+//
+// - MaxTTL: The longest time a positive response is cached. Defaults to one day.
+//
+// - MaxNegativeTTL: The longest time a negative response is cached. Defaults to three hours.
+//
+// - StaleWindow: How long after expiring a response may still be served. Zero disables serve-stale.
+//
+// - StaleAnswerTTL: The TTL of the records of stale responses. Defaults to 30 seconds.
+//
+// - PrefetchHits: How many times a response must have been served before it is prefetched. Zero disables prefetch.
+//
+// - PrefetchWindow: How close to expiring a popular response is refreshed.
+type Cache struct {
+	Capacity       int
+	MinTTL         time.Duration
+	MaxTTL         time.Duration
+	MaxNegativeTTL time.Duration
+	StaleWindow    time.Duration
+	StaleAnswerTTL time.Duration
+	PrefetchHits   int
+	PrefetchWindow time.Duration
+
+	mu      sync.Mutex
+	entries map[Key]*list.Element
+	lru     *list.List
+	hits    uint64
+	misses  uint64
+	stale   uint64
+
+	// now returns the current time, tests replace it to move the clock
+	now func() time.Time
+}
+
+// New creates an empty Cache holding at most capacity responses.
+//
+// Parameters:
+// - capacity: The maximum number of cached responses.
+//
+// Returns:
+// - A pointer to the Cache.
+func New(capacity int) *Cache {
+	return &Cache{
+		Capacity:       capacity,
+		MaxTTL:         defaultMaxTTL,
+		MaxNegativeTTL: defaultMaxNegativeTTL,
+		StaleAnswerTTL: defaultStaleAnswerTTL,
+		entries:        make(map[Key]*list.Element),
+		lru:            list.New(),
+		now:            time.Now,
+	}
+}
+
+// Lookup returns the cached response for the key.
+// The response only holds the cached sections and the RCode; callers copy them into a response
+// to their own query. Fresh responses carry TTLs decremented by the time spent in the cache,
+// stale responses carry StaleAnswerTTL. Entries past the stale window are removed.
+//
+// Parameters:
+// - key: The key of the question.
+//
+// Returns:
+// - The Result of the lookup.
+func (c *Cache) Lookup(key Key) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return Result{Status: Miss}
+	}
+
+	now := c.now()
+	cached := element.Value.(*entry)
+	elapsed := now.Sub(cached.stored)
+
+	switch {
+	case elapsed < cached.ttl:
+		c.lru.MoveToFront(element)
+		c.hits++
+		cached.hits++
+
+		result := Result{Response: cached.withElapsed(elapsed), Status: Fresh}
+		if c.PrefetchHits > 0 && cached.hits >= c.PrefetchHits && cached.ttl-elapsed <= c.PrefetchWindow {
+			result.Refresh = cached.startRefresh(now)
+		}
+		return result
+
+	case elapsed < cached.ttl+c.StaleWindow:
+		c.lru.MoveToFront(element)
+		c.hits++
+		c.stale++
+
+		return Result{
+			Response: cached.withTTL(uint32(c.StaleAnswerTTL / time.Second)),
+			Status:   Stale,
+			Refresh:  cached.startRefresh(now),
+		}
+
+	default:
+		c.remove(element)
+		c.misses++
+		return Result{Status: Miss}
+	}
+}
+
+// Set caches the response to the question identified by key, replacing any cached response.
+// Responses which cannot be cached are ignored: truncated responses, error responses other than
+// NXDOMAIN, and negative responses without a SOA record. A failed refresh therefore keeps
+// serving the stale response.
+//
+// Parameters:
+// - key: The key of the question.
+// - response: The response to cache.
+func (c *Cache) Set(key Key, response *dns.Message) {
+	ttl, negative, ok := c.lifetime(response)
+	if !ok {
+		return
+	}
+
+	cached := &entry{
+		key:      key,
+		response: c.prepare(response, ttl, negative),
+		stored:   c.now(),
+		ttl:      ttl,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = cached
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(cached)
+	for c.lru.Len() > c.Capacity {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Stats returns the hit and miss counters and the number of cached responses.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Hits: c.hits, Misses: c.misses, Stale: c.stale, Size: c.lru.Len()}
+}
+
+// String returns the counters in the form used by LogStats.
+func (s Stats) String() string {
+	return fmt.Sprintf("%d hits (%d stale), %d misses, %d entries", s.Hits, s.Stale, s.Misses, s.Size)
+}
+
+// LogStats prints the counters of the cache each interval until ctx is cancelled.
+// It blocks, so it is usually run on its own goroutine.
+//
+// Parameters:
+// - ctx: Stops the logging.
+// - interval: The time between two log lines.
+func (c *Cache) LogStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fmt.Println("Cache:", c.Stats())
+		}
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
+
+// lifetime decides how long a response may be cached and whether it is a negative response.
+func (c *Cache) lifetime(response *dns.Message) (time.Duration, bool, bool) {
+	if response.Header.TC {
+		return 0, false, false
+	}
+
+	switch {
+	case response.Header.RCode == dns.RCodeSuccess && len(response.Answers) > 0:
+		ttl := c.clamp(minTTL(response), c.MaxTTL)
+		return ttl, false, ttl > 0
+
+	case response.Header.RCode == dns.RCodeSuccess || response.Header.RCode == dns.RCodeNameError:
+		soa, ok := negativeTTL(response)
+		if !ok {
+			return 0, true, false
+		}
+		ttl := c.clamp(soa, c.MaxNegativeTTL)
+		return ttl, true, ttl > 0
+
+	default:
+		return 0, false, false
+	}
+}
+
+// clamp limits a TTL to [MinTTL, upper].
+func (c *Cache) clamp(ttl, upper time.Duration) time.Duration {
+	if upper > 0 && ttl > upper {
+		ttl = upper
+	}
+	if ttl < c.MinTTL {
+		ttl = c.MinTTL
+	}
+	return ttl
+}
+
+// minTTL returns the smallest TTL of the records of a response, ignoring the OPT record.
+func minTTL(response *dns.Message) time.Duration {
+	lowest := ^uint32(0)
+	for _, section := range [][]dns.Answer{response.Answers, response.Authority, response.Additional} {
+		for _, record := range section {
+			if record.Type != dns.TypeOPT {
+				lowest = min(lowest, record.TTL)
+			}
+		}
+	}
+	return time.Duration(lowest) * time.Second
+}
+
+// negativeTTL returns the TTL of a negative response: the smaller of the TTL of the SOA record
+// in the authority section and its MINIMUM field (RFC 2308 section 5).
+func negativeTTL(response *dns.Message) (time.Duration, bool) {
+	for _, record := range response.Authority {
+		soa, ok := record.RData.(*dns.SOA)
+		if !ok {
+			continue
+		}
+		return time.Duration(min(record.TTL, soa.Minimum)) * time.Second, true
+	}
+	return 0, false
+}
+
+// prepare copies the parts of a response worth caching and clamps the TTL of every record,
+// so a record never outlives the entry. The OPT record is left out, it belongs to the exchange
+// with a single client and its TTL field is not a TTL.
+func (c *Cache) prepare(response *dns.Message, ttl time.Duration, negative bool) *dns.Message {
+	clamp := func(records []dns.Answer) []dns.Answer {
+		copied := make([]dns.Answer, 0, len(records))
+		for _, record := range records {
+			if record.Type == dns.TypeOPT {
+				continue
+			}
+
+			recordTTL := time.Duration(record.TTL) * time.Second
+			if negative {
+				recordTTL = ttl
+			} else {
+				recordTTL = c.clamp(recordTTL, c.MaxTTL)
+			}
+			record.TTL = uint32(recordTTL / time.Second)
+			copied = append(copied, record)
+		}
+		return copied
+	}
+
+	return &dns.Message{
+		Header: dns.Header{
+			QR:    true,
+			RA:    response.Header.RA,
+			RCode: response.Header.RCode,
+		},
+		Answers:    clamp(response.Answers),
+		Authority:  clamp(response.Authority),
+		Additional: clamp(response.Additional),
+	}
+}
+
+// withElapsed copies the cached response with every TTL decremented by the elapsed time.
+func (e *entry) withElapsed(elapsed time.Duration) *dns.Message {
+	elapsedSeconds := uint32(elapsed / time.Second)
+
+	return e.copyWith(func(ttl uint32) uint32 {
+		if ttl > elapsedSeconds {
+			return ttl - elapsedSeconds
+		}
+		return 0
+	})
+}
+
+// withTTL copies the cached response with every TTL set to ttl.
+func (e *entry) withTTL(ttl uint32) *dns.Message {
+	return e.copyWith(func(uint32) uint32 { return ttl })
+}
+
+// copyWith copies the cached response, replacing the TTL of every record with adjust(TTL).
+func (e *entry) copyWith(adjust func(ttl uint32) uint32) *dns.Message {
+	adjusted := func(records []dns.Answer) []dns.Answer {
+		copied := make([]dns.Answer, len(records))
+		for i, record := range records {
+			record.TTL = adjust(record.TTL)
+			copied[i] = record
+		}
+		return copied
+	}
+
+	return &dns.Message{
+		Header:     e.response.Header,
+		Answers:    adjusted(e.response.Answers),
+		Authority:  adjusted(e.response.Authority),
+		Additional: adjusted(e.response.Additional),
+	}
+}
+
+// startRefresh reports whether the caller should refresh the entry and records that it does.
+// Only one refresh starts per refreshBackoff, so a failing upstream is not asked on every hit.
+func (e *entry) startRefresh(now time.Time) bool {
+	if now.Sub(e.refreshStarted) < refreshBackoff {
+		return false
+	}
+	e.refreshStarted = now
+	return true
+}
@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"net"
+	"testing"
+	"time"
+)
+
+var testKey = Key{Name: "example.com", Type: dns.TypeA, Class: dns.ClassIN}
+
+// newTestCache creates a cache whose clock only moves when the returned function advances it.
+func newTestCache(capacity int) (*Cache, func(time.Duration)) {
+	c := New(capacity)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return clock }
+	return c, func(d time.Duration) { clock = clock.Add(d) }
+}
+
+// addressResponse returns a response with an A record for example.com per TTL.
+func addressResponse(ttls ...uint32) *dns.Message {
+	response := &dns.Message{Header: dns.Header{QR: true, RA: true}}
+	for i, ttl := range ttls {
+		response.Answers = append(response.Answers, dns.Answer{
+			Name: "example.com", Type: dns.TypeA, Class: dns.ClassIN, TTL: ttl,
+			RData: &dns.A{IP: net.IPv4(192, 0, 2, byte(i+1)).To4()},
+		})
+	}
+	return response
+}
+
+// negativeResponse returns an empty response with the rcode and a SOA record with the TTL and MINIMUM.
+func negativeResponse(rcode uint8, ttl, minimum uint32) *dns.Message {
+	return &dns.Message{
+		Header: dns.Header{QR: true, RCode: rcode},
+		Authority: []dns.Answer{{
+			Name: "example.com", Type: dns.TypeSOA, Class: dns.ClassIN, TTL: ttl,
+			RData: &dns.SOA{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 1, Minimum: minimum},
+		}},
+	}
+}
+
+// ttls returns the TTLs of the records of the answer and authority sections.
+func ttls(response *dns.Message) []uint32 {
+	var found []uint32
+	for _, record := range append(response.Answers, response.Authority...) {
+		found = append(found, record.TTL)
+	}
+	return found
+}
+
+// expectTTLs looks the test key up and checks its status and record TTLs.
+func expectTTLs(t *testing.T, c *Cache, status Status, want ...uint32) *dns.Message {
+	t.Helper()
+
+	result := c.Lookup(testKey)
+	if result.Status != status {
+		t.Fatalf("lookup returned status %d, expected %d", result.Status, status)
+	}
+	if status == Miss {
+		return nil
+	}
+
+	got := ttls(result.Response)
+	if len(got) != len(want) {
+		t.Fatalf("got TTLs %v, expected %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got TTLs %v, expected %v", got, want)
+		}
+	}
+	return result.Response
+}
+
+func TestLookupDecrementsTTLs(t *testing.T) {
+	c, advance := newTestCache(10)
+
+	expectTTLs(t, c, Miss)
+	c.Set(testKey, addressResponse(300, 60))
+
+	expectTTLs(t, c, Fresh, 300, 60)
+	advance(10 * time.Second)
+	expectTTLs(t, c, Fresh, 290, 50)
+
+	// The entry lives as long as its smallest TTL
+	advance(50 * time.Second)
+	expectTTLs(t, c, Miss)
+
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 2 || stats.Size != 0 {
+		t.Errorf("got stats %s, expected 2 hits, 2 misses and no entries", stats)
+	}
+}
+
+func TestSetClampsTTLs(t *testing.T) {
+	c, advance := newTestCache(10)
+	c.MinTTL = 30 * time.Second
+	c.MaxTTL = 100 * time.Second
+
+	c.Set(testKey, addressResponse(5))
+	expectTTLs(t, c, Fresh, 30)
+	advance(29 * time.Second)
+	expectTTLs(t, c, Fresh, 1)
+
+	c.Set(testKey, addressResponse(1000, 50))
+	expectTTLs(t, c, Fresh, 100, 50)
+	advance(50 * time.Second)
+	expectTTLs(t, c, Miss)
+}
+
+func TestSetCachesNegativeResponses(t *testing.T) {
+	tests := []struct {
+		description string
+		response    *dns.Message
+		lifetime    uint32
+	}{
+		{"NXDOMAIN uses the SOA MINIMUM", negativeResponse(dns.RCodeNameError, 300, 60), 60},
+		{"NODATA uses the SOA TTL", negativeResponse(dns.RCodeSuccess, 30, 3600), 30},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			c, advance := newTestCache(10)
+			c.Set(testKey, test.response)
+
+			response := expectTTLs(t, c, Fresh, test.lifetime)
+			if response.Header.RCode != test.response.Header.RCode {
+				t.Errorf("cached rcode %d, expected %d", response.Header.RCode, test.response.Header.RCode)
+			}
+			advance(time.Duration(test.lifetime-1) * time.Second)
+			expectTTLs(t, c, Fresh, 1)
+			advance(time.Second)
+			expectTTLs(t, c, Miss)
+		})
+	}
+}
+
+func TestSetIgnoresUncacheableResponses(t *testing.T) {
+	withoutSOA := negativeResponse(dns.RCodeNameError, 300, 60)
+	withoutSOA.Authority = nil
+	truncated := addressResponse(300)
+	truncated.Header.TC = true
+	failure := addressResponse(300)
+	failure.Header.RCode = dns.RCodeServerFailure
+
+	for description, response := range map[string]*dns.Message{
+		"negative without SOA": withoutSOA,
+		"truncated":            truncated,
+		"server failure":       failure,
+	} {
+		c, _ := newTestCache(10)
+		c.Set(testKey, response)
+		if result := c.Lookup(testKey); result.Status != Miss {
+			t.Errorf("%s response was cached", description)
+		}
+	}
+}
+
+func TestSetEvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestCache(2)
+	keys := []Key{
+		{Name: "a.example", Type: dns.TypeA, Class: dns.ClassIN},
+		{Name: "b.example", Type: dns.TypeA, Class: dns.ClassIN},
+		{Name: "c.example", Type: dns.TypeA, Class: dns.ClassIN},
+	}
+
+	c.Set(keys[0], addressResponse(300))
+	c.Set(keys[1], addressResponse(300))
+	// Using a makes b the least recently used entry
+	c.Lookup(keys[0])
+	c.Set(keys[2], addressResponse(300))
+
+	for i, want := range []Status{Fresh, Miss, Fresh} {
+		if got := c.Lookup(keys[i]).Status; got != want {
+			t.Errorf("%s has status %d, expected %d", keys[i].Name, got, want)
+		}
+	}
+	if size := c.Stats().Size; size != 2 {
+		t.Errorf("cache holds %d entries, expected 2", size)
+	}
+}
+
+func TestKeyOfIgnoresCase(t *testing.T) {
+	if KeyOf(dns.Question{Name: "WWW.Example.COM.", Type: dns.TypeA, Class: dns.ClassIN}) != KeyOf(dns.Question{Name: "www.example.com", Type: dns.TypeA, Class: dns.ClassIN}) {
+		t.Error("keys of the same name in different case differ")
+	}
+}
+
+func TestLookupServesStale(t *testing.T) {
+	c, advance := newTestCache(10)
+	c.StaleWindow = time.Minute
+	c.StaleAnswerTTL = 5 * time.Second
+
+	c.Set(testKey, addressResponse(10))
+	advance(10 * time.Second)
+
+	// The first stale lookup asks for a refresh, the next ones wait for refreshBackoff
+	expectTTLs(t, c, Stale, 5)
+	if c.Lookup(testKey).Refresh {
+		t.Error("second stale lookup asked for another refresh")
+	}
+	advance(refreshBackoff)
+	if !c.Lookup(testKey).Refresh {
+		t.Errorf("stale lookup %s after the last refresh started did not ask for a refresh", refreshBackoff)
+	}
+
+	// A failed refresh stores nothing, so the stale response keeps being served
+	failure := addressResponse(10)
+	failure.Header.RCode = dns.RCodeServerFailure
+	c.Set(testKey, failure)
+	expectTTLs(t, c, Stale, 5)
+
+	advance(c.StaleWindow - refreshBackoff)
+	expectTTLs(t, c, Miss)
+
+	if stats := c.Stats(); stats.Stale != 4 || stats.Hits != 4 {
+		t.Errorf("got stats %s, expected 4 stale hits", stats)
+	}
+}
+
+func TestRefreshedStaleEntryIsFresh(t *testing.T) {
+	c, advance := newTestCache(10)
+	c.StaleWindow = time.Minute
+
+	c.Set(testKey, addressResponse(10))
+	advance(15 * time.Second)
+
+	result := c.Lookup(testKey)
+	if result.Status != Stale || !result.Refresh {
+		t.Fatalf("got status %d and refresh %t, expected a stale response to refresh", result.Status, result.Refresh)
+	}
+	if ttl := ttls(result.Response)[0]; ttl != uint32(defaultStaleAnswerTTL/time.Second) {
+		t.Errorf("stale record has TTL %d, expected the default %s", ttl, defaultStaleAnswerTTL)
+	}
+
+	// The refreshed response is fresh again
+	c.Set(testKey, addressResponse(10))
+	expectTTLs(t, c, Fresh, 10)
+}
+
+func TestLookupPrefetchesPopularEntries(t *testing.T) {
+	c, advance := newTestCache(10)
+	c.PrefetchHits = 3
+	c.PrefetchWindow = 10 * time.Second
+
+	popular := Key{Name: "popular.example", Type: dns.TypeA, Class: dns.ClassIN}
+	c.Set(testKey, addressResponse(100))
+	c.Set(popular, addressResponse(100))
+
+	for i := 0; i < 3; i++ {
+		if c.Lookup(popular).Refresh {
+			t.Fatal("asked for a prefetch far from expiry")
+		}
+	}
+	advance(91 * time.Second)
+
+	if !c.Lookup(popular).Refresh {
+		t.Error("popular entry close to expiry was not prefetched")
+	}
+	if c.Lookup(popular).Refresh {
+		t.Error("asked for a second prefetch before refreshBackoff")
+	}
+	if c.Lookup(testKey).Refresh {
+		t.Error("entry with fewer than PrefetchHits hits was prefetched")
+	}
+}
@@ -9,7 +9,7 @@ func ShowDNsPacketAsHex(packet []byte) {
 	fmt.Println("Header")
 
 	offset := 0
-	for i := 0; i < dns.HeaderSize; i += 2 {
+	for i := 0; i < dns.HeaderSize && offset+2 <= len(packet); i += 2 {
 		fmt.Println(BytesToHex(packet[offset : offset+2]))
 		offset += 2
 	}
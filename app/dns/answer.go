@@ -1,6 +1,9 @@
 package dns
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+)
 
 // Answer represents a DNS answer as defined in RFC 1035.
 // A DNS answer is used in the answer section of a DNS response
@@ -10,77 +13,122 @@ import "encoding/binary"
 //
 // - Name: The domain name to which this resource record pertains. This is a fully qualified domain name (FQDN).
 //
-// - Type: A two-octet code which specifies the type of the resource record. The following values are defined:
-//   - 1: A (IPv4 address)
-//   - 2: NS (authoritative name server)
-//   - 5: CNAME (canonical name for an alias)
-//   - 6: SOA (start of a zone of authority)
-//   - 12: PTR (domain name pointer)
-//   - 15: MX (mail exchange)
-//   - 28: AAAA (IPv6 address)
-//   - 255: ANY (any type)
+// - Type: A two-octet code which specifies the type of the resource record, such as TypeA or TypeMX.
 //
-// - Class: A two-octet code that specifies the class of the resource record. The following values are defined:
-//   - 1: IN (Internet)
-//   - 3: CH (Chaos)
-//   - 4: HS (Hesiod)
-//   - 255: ANY (any class)
+// - Class: A two-octet code that specifies the class of the resource record, usually ClassIN.
 //
 // - TTL: A 32-bit unsigned integer that specifies the time interval (in seconds) that the resource record may be cached
 // before it should be discarded.
 //
-// - RDLength: An unsigned 16-bit integer that specifies the length in octets of the RData field.
-//
-// - RData: A variable length string of octets that describes the resource.
-// The format of this information varies according to the Type and Class of the resource record.
+// - RData: The data that describes the resource. Its format varies according to the Type of the resource record,
+// see the RData implementations such as A, MX or SOA. The RDLength field of the wire format is computed
+// from it when the record is marshalled.
 type Answer struct {
-	Name     string
-	Type     uint16
-	Class    uint16
-	TTL      uint32
-	RDLength uint16
-	RData    []byte
+	Name  string
+	Type  Type
+	Class Class
+	TTL   uint32
+	RData RData
 }
 
 // Marshal encodes the DNS Answer into a byte slice.
-// It marshals the Name, Type, Class, TTL, RDLength, and RData fields of the Answer
+// It marshals the Name, Type, Class, TTL and RData fields of the Answer
 // and concatenates their byte representations into a single byte slice.
+// The RDLength field is derived from the length of the marshalled RData.
 //
 // Returns:
 // - A byte slice containing the encoded DNS Answer.
-func (a *Answer) Marshal() []byte {
-	encodedName := EncodeLabel(a.Name)
+// - An error if the name or the RData cannot be encoded.
+func (a *Answer) Marshal() ([]byte, error) {
+	return a.marshalTo(nil, nil)
+}
+
+// marshalTo appends the wire form of the Answer to msg, the message built so far.
+// Names in the owner field and in the RData are compressed with the given table, see appendName.
+func (a *Answer) marshalTo(msg []byte, compression map[string]int) ([]byte, error) {
+	msg, err := appendName(msg, a.Name, compression)
+	if err != nil {
+		return nil, err
+	}
+
+	msg = binary.BigEndian.AppendUint16(msg, uint16(a.Type))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(a.Class))
+	msg = binary.BigEndian.AppendUint32(msg, a.TTL)
 
-	encoded := make([]byte, len(encodedName)+10+len(a.RData))
-	offset := 0
+	lengthOffset := len(msg)
+	msg = append(msg, 0, 0) // RDLength, filled in once the RData is written
 
-	copy(encoded[offset:], encodedName)
-	offset += len(encodedName)
+	if a.RData != nil {
+		msg, err = a.RData.Marshal(msg, compression)
+		if err != nil {
+			return nil, fmt.Errorf("record data of '%s': %w", a.Name, err)
+		}
+	}
 
-	binary.BigEndian.PutUint16(encoded[offset:], a.Type)
-	offset += 2
+	rdLength := len(msg) - lengthOffset - 2
+	if rdLength > 0xFFFF {
+		return nil, fmt.Errorf("record data of '%s' exceeds 65535 bytes", a.Name)
+	}
+	binary.BigEndian.PutUint16(msg[lengthOffset:], uint16(rdLength))
 
-	binary.BigEndian.PutUint16(encoded[offset:], a.Class)
-	offset += 2
+	return msg, nil
+}
 
-	binary.BigEndian.PutUint32(encoded[offset:], a.TTL)
-	offset += 4
+// unmarshalAnswers decodes count resource records starting at offset in the DNS message.
+// It returns the decoded records together with the offset of the first byte after the last record.
+func unmarshalAnswers(dnsMessage []byte, offset int, count uint16) ([]Answer, int, error) {
+	answers := make([]Answer, 0, count)
 
-	binary.BigEndian.PutUint16(encoded[offset:], a.RDLength)
-	offset += 2
+	for i := 0; i < int(count); i++ {
+		if offset >= len(dnsMessage) {
+			return nil, offset, fmt.Errorf("%w: expected %d records but found %d", ErrShortMessage, count, i)
+		}
 
-	copy(encoded[offset:], a.RData)
+		answer, bytesRead, err := unmarshalAnswer(dnsMessage, offset)
+		if err != nil {
+			return nil, offset, err
+		}
+
+		answers = append(answers, answer)
+		offset += bytesRead
+	}
 
-	return encoded
+	return answers, offset, nil
 }
 
-func FromQuestion(q Question) Answer {
-	return Answer{
-		Name:     q.Name,
-		Type:     1,
-		Class:    1,
-		TTL:      60,
-		RDLength: 4,
-		RData:    []byte("\x08\x08\x08\x08"),
+// unmarshalAnswer decodes a single resource record starting at offset in the DNS message.
+// It returns the decoded record and the number of bytes it occupies.
+func unmarshalAnswer(dnsMessage []byte, offset int) (Answer, int, error) {
+	start := offset
+	name, bytesRead, err := parseLabel(dnsMessage[offset:], dnsMessage)
+	if err != nil {
+		return Answer{}, 0, fmt.Errorf("record at offset %d: %w", start, err)
 	}
+	offset += bytesRead
+
+	fixedByteCount := 10 // type + class + ttl + rdlength
+	if offset+fixedByteCount > len(dnsMessage) {
+		return Answer{}, 0, fmt.Errorf("%w: incomplete record at offset %d", ErrShortMessage, start)
+	}
+
+	answer := Answer{
+		Name:  name,
+		Type:  Type(binary.BigEndian.Uint16(dnsMessage[offset:])),
+		Class: Class(binary.BigEndian.Uint16(dnsMessage[offset+2:])),
+		TTL:   binary.BigEndian.Uint32(dnsMessage[offset+4:]),
+	}
+	rdLength := int(binary.BigEndian.Uint16(dnsMessage[offset+8:]))
+	offset += fixedByteCount
+
+	if offset+rdLength > len(dnsMessage) {
+		return Answer{}, 0, fmt.Errorf("%w: record data of '%s' exceeds the message", ErrShortMessage, name)
+	}
+
+	answer.RData = newRData(answer.Type)
+	if err := answer.RData.Unmarshal(dnsMessage, offset, rdLength); err != nil {
+		return Answer{}, 0, fmt.Errorf("record data of '%s': %w", name, err)
+	}
+	offset += rdLength
+
+	return answer, offset - start, nil
 }
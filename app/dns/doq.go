@@ -0,0 +1,242 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DoQALPN is the application protocol of DNS over QUIC, negotiated through ALPN (RFC 9250 section 4.1.1).
+const DoQALPN = "doq"
+
+// Error codes closing a DNS-over-QUIC connection (RFC 9250 section 4.3).
+const (
+	DoQNoError          = 0x0
+	DoQInternalError    = 0x1
+	DoQProtocolError    = 0x2
+	DoQRequestCancelled = 0x3
+	DoQExcessiveLoad    = 0x4
+)
+
+// The QUIC transport itself is not part of this package: the standard library only provides
+// the TLS handshake of QUIC. QUICListener, QUICConn and QUICStream describe the little DNS over QUIC
+// needs from a QUIC implementation, so one such as quic-go can be plugged in with a small adapter.
+
+// QUICListener accepts incoming QUIC connections.
+//
+// Methods:
+//
+// - Accept: Waits for the next connection whose handshake completed.
+//
+// - Addr: Returns the address the listener accepts connections on.
+//
+// - Close: Stops accepting connections.
+type QUICListener interface {
+	Accept(ctx context.Context) (QUICConn, error)
+	Addr() net.Addr
+	Close() error
+}
+
+// QUICConn is an established QUIC connection carrying any number of streams.
+//
+// Methods:
+//
+// - AcceptStream: Waits for the next stream opened by the peer.
+//
+// - OpenStream: Opens a new bidirectional stream, waiting while the peer allows no further streams.
+//
+// - LocalAddr: Returns the local address of the connection.
+//
+// - RemoteAddr: Returns the address of the peer.
+//
+// - CloseWithError: Closes the connection with an application error code, such as DoQProtocolError.
+type QUICConn interface {
+	AcceptStream(ctx context.Context) (QUICStream, error)
+	OpenStream(ctx context.Context) (QUICStream, error)
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	CloseWithError(code uint64, reason string) error
+}
+
+// QUICStream is a bidirectional QUIC stream. Close only ends the sending direction with a STREAM FIN,
+// the stream can still be read afterwards.
+type QUICStream interface {
+	io.ReadWriteCloser
+	SetDeadline(t time.Time) error
+}
+
+// QUICDialer opens QUIC connections to DNS-over-QUIC servers, see resolve.Forwarder.
+//
+// Methods:
+//
+// - DialQUIC: Connects to the address and completes the handshake with the given TLS configuration.
+type QUICDialer interface {
+	DialQUIC(ctx context.Context, address string, config *tls.Config) (QUICConn, error)
+}
+
+// QUICTLSConfig returns a copy of a TLS configuration set up for DNS over QUIC:
+// QUIC requires TLS 1.3 and the "doq" application protocol is negotiated through ALPN.
+//
+// Parameters:
+// - config: The TLS configuration of a client or server, nil for the default one.
+//
+// Returns:
+// - A pointer to the new TLS configuration.
+func QUICTLSConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	config = config.Clone()
+	config.MinVersion = tls.VersionTLS13
+	config.NextProtos = []string{DoQALPN}
+	return config
+}
+
+// ServeQUIC accepts DNS-over-QUIC connections (RFC 9250) from the listener and serves each of them
+// on its own goroutine. Every query arrives on its own stream, framed like over TCP, and is answered
+// on the same stream, so a slow query never holds up the others. Queries must carry the message ID 0;
+// any other ID closes the connection with DoQProtocolError. Connections are closed after IdleTimeout
+// without a query.
+//
+// Parameters:
+// - listener: The listener to accept connections from, whose TLS configuration should come from QUICTLSConfig.
+//
+// Returns:
+// - ErrServerClosed after Shutdown, or the error that stopped accepting connections.
+func (s *Server) ServeQUIC(listener QUICListener) error {
+	if err := s.track(listener); err != nil {
+		return err
+	}
+
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		go s.serveQUICConn(conn)
+	}
+}
+
+// serveQUICConn accepts the streams of a connection and serves each of them on its own goroutine
+// until the client closes the connection or no query arrives for IdleTimeout.
+func (s *Server) serveQUICConn(conn QUICConn) {
+	var active atomic.Int32
+	idleTimeout := withDefault(s.IdleTimeout, defaultIdleTimeout)
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), idleTimeout)
+		stream, err := conn.AcceptStream(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && active.Load() > 0 {
+				// Not idle while queries are still being answered
+				continue
+			}
+			_ = conn.CloseWithError(DoQNoError, "")
+			return
+		}
+
+		active.Add(1)
+		go func() {
+			defer active.Add(-1)
+			s.serveQUICStream(conn, stream)
+		}()
+	}
+}
+
+// serveQUICStream answers the single query of a stream and ends the stream after the response.
+// Malformed framing and message IDs other than 0 are protocol errors closing the whole connection
+// (RFC 9250 section 4.3.3).
+func (s *Server) serveQUICStream(conn QUICConn, stream QUICStream) {
+	writer := &quicResponseWriter{
+		conn:         conn,
+		stream:       stream,
+		writeTimeout: withDefault(s.WriteTimeout, defaultWriteTimeout),
+	}
+	defer writer.finish()
+
+	if err := stream.SetDeadline(time.Now().Add(withDefault(s.ReadTimeout, defaultReadTimeout))); err != nil {
+		fmt.Println("Failed to set deadline of QUIC stream from", conn.RemoteAddr(), ":", err)
+		return
+	}
+
+	packet, err := ReadTCPMessage(stream)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			fmt.Println("Timed out receiving query from", conn.RemoteAddr())
+			return
+		}
+		fmt.Println("Error receiving data from", conn.RemoteAddr(), ":", err)
+		_ = conn.CloseWithError(DoQProtocolError, "malformed query")
+		return
+	}
+
+	if header, err := UnmarshalHeader(packet); err == nil && header.ID != 0 {
+		fmt.Println("Closing connection to", conn.RemoteAddr(), "after a query with message ID", header.ID)
+		_ = conn.CloseWithError(DoQProtocolError, "message ID is not 0")
+		return
+	}
+
+	s.serveDNS(writer, packet, s.handler())
+}
+
+// quicResponseWriter writes the response to a query received on a QUIC stream.
+// A stream carries exactly one response, further writes fail.
+type quicResponseWriter struct {
+	conn         QUICConn
+	stream       QUICStream
+	writeTimeout time.Duration
+
+	mu      sync.Mutex
+	written bool
+}
+
+func (w *quicResponseWriter) LocalAddr() net.Addr  { return w.conn.LocalAddr() }
+func (w *quicResponseWriter) RemoteAddr() net.Addr { return w.conn.RemoteAddr() }
+func (w *quicResponseWriter) Network() string      { return "quic" }
+
+func (w *quicResponseWriter) WriteMsg(m *Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.written {
+		return errors.New("response already written to the QUIC stream")
+	}
+	w.written = true
+
+	// The ID of DoQ messages is always 0, whatever the handler wrote
+	response := *m
+	response.Header.ID = 0
+	encoded, err := response.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := w.stream.SetDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		return err
+	}
+	return WriteTCPMessage(w.stream, encoded)
+}
+
+// finish ends the stream, which tells the client that no further response follows.
+func (w *quicResponseWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.written = true
+	if err := w.stream.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		fmt.Println("Failed to close QUIC stream:", err)
+	}
+}
@@ -0,0 +1,311 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pipeStream is one end of an in-memory QUIC stream. Close only ends its writing direction.
+type pipeStream struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func (s *pipeStream) Read(p []byte) (int, error)  { return s.r.Read(p) }
+func (s *pipeStream) Write(p []byte) (int, error) { return s.w.Write(p) }
+func (s *pipeStream) Close() error                { return s.w.Close() }
+func (s *pipeStream) SetDeadline(time.Time) error { return nil }
+
+// pipeState is shared by both ends of an in-memory QUIC connection.
+type pipeState struct {
+	mu      sync.Mutex
+	pipes   []*io.PipeReader
+	closed  chan struct{}
+	code    atomic.Int64
+	closing sync.Once
+}
+
+// pipeConn is one end of an in-memory QUIC connection. Closing either end closes both and every stream.
+type pipeConn struct {
+	state  *pipeState
+	accept chan QUICStream
+	open   chan QUICStream
+}
+
+// newPipeConns returns both ends of an in-memory QUIC connection.
+func newPipeConns() (*pipeConn, *pipeConn) {
+	state := &pipeState{closed: make(chan struct{})}
+	state.code.Store(-1)
+	toServer, toClient := make(chan QUICStream), make(chan QUICStream)
+	return &pipeConn{state: state, accept: toClient, open: toServer},
+		&pipeConn{state: state, accept: toServer, open: toClient}
+}
+
+func (c *pipeConn) AcceptStream(ctx context.Context) (QUICStream, error) {
+	select {
+	case stream := <-c.accept:
+		return stream, nil
+	case <-c.state.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *pipeConn) OpenStream(ctx context.Context) (QUICStream, error) {
+	inRead, inWrite := io.Pipe()
+	outRead, outWrite := io.Pipe()
+	c.state.mu.Lock()
+	c.state.pipes = append(c.state.pipes, inRead, outRead)
+	c.state.mu.Unlock()
+
+	select {
+	case c.open <- &pipeStream{r: outRead, w: inWrite}:
+		return &pipeStream{r: inRead, w: outWrite}, nil
+	case <-c.state.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 853}
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4321}
+}
+
+func (c *pipeConn) CloseWithError(code uint64, reason string) error {
+	c.state.closing.Do(func() {
+		c.state.code.Store(int64(code))
+		close(c.state.closed)
+
+		c.state.mu.Lock()
+		defer c.state.mu.Unlock()
+		for _, pipe := range c.state.pipes {
+			_ = pipe.CloseWithError(net.ErrClosed)
+		}
+	})
+	return nil
+}
+
+// closeCode waits for the connection to be closed and returns its error code.
+func (c *pipeConn) closeCode(t *testing.T) uint64 {
+	t.Helper()
+
+	select {
+	case <-c.state.closed:
+		return uint64(c.state.code.Load())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection was not closed")
+		return 0
+	}
+}
+
+// pipeListener accepts in-memory QUIC connections created by dial.
+type pipeListener struct {
+	conns     chan QUICConn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *pipeListener) Accept(ctx context.Context) (QUICConn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 853}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+// dial connects a new client to the listener.
+func (l *pipeListener) dial(t *testing.T) *pipeConn {
+	t.Helper()
+
+	client, server := newPipeConns()
+	select {
+	case l.conns <- server:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server does not accept connections")
+	}
+	t.Cleanup(func() { _ = client.CloseWithError(DoQNoError, "") })
+	return client
+}
+
+// startQUICServer serves DNS over QUIC for the test on an in-memory listener.
+func startQUICServer(t *testing.T, server *Server) *pipeListener {
+	t.Helper()
+
+	listener := &pipeListener{conns: make(chan QUICConn), closed: make(chan struct{})}
+	go server.ServeQUIC(listener)
+	t.Cleanup(server.Shutdown)
+	return listener
+}
+
+// sendQUIC sends an encoded query on a new stream of the connection and ends the stream.
+func sendQUIC(t *testing.T, conn QUICConn, packet []byte) QUICStream {
+	t.Helper()
+
+	stream, err := conn.OpenStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTCPMessage(stream, packet); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// readQUIC reads the response from a stream.
+func readQUIC(t *testing.T, stream QUICStream) *Message {
+	t.Helper()
+
+	encoded, err := ReadTCPMessage(stream)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	response, err := UnMarshallMessage(encoded)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	return response
+}
+
+// encodeQuery returns the wire format of an A query for name.
+func encodeQuery(t *testing.T, id uint16, name string) []byte {
+	t.Helper()
+
+	query := &Message{
+		Header:    Header{ID: id, RD: true},
+		Questions: []Question{{Name: name, Type: TypeA, Class: ClassIN}},
+	}
+	packet, err := query.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func TestServeQUICAnswersStreamsIndependently(t *testing.T) {
+	release := make(chan struct{})
+	var network atomic.Value
+	listener := startQUICServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Message) {
+		network.Store(w.Network())
+		if r.Questions[0].Name == "slow.example.com" {
+			<-release
+		}
+		response := NewResponse(r)
+		response.Header.ID = 42
+		_ = w.WriteMsg(response)
+	})})
+	conn := listener.dial(t)
+
+	slow := sendQUIC(t, conn, encodeQuery(t, 0, "slow.example.com"))
+	fast := sendQUIC(t, conn, encodeQuery(t, 0, "fast.example.com"))
+
+	// The second stream is answered while the first query is still being handled
+	if response := readQUIC(t, fast); response == nil || response.Questions[0].Name != "fast.example.com" {
+		t.Fatalf("got response %+v on the second stream", response)
+	}
+	close(release)
+	response := readQUIC(t, slow)
+	if response == nil || response.Questions[0].Name != "slow.example.com" {
+		t.Fatalf("got response %+v on the first stream", response)
+	}
+	if response.Header.ID != 0 {
+		t.Errorf("got response ID %d, expected 0 whatever the handler wrote", response.Header.ID)
+	}
+	if got := network.Load(); got != "quic" {
+		t.Errorf("handler saw network '%v', expected quic", got)
+	}
+
+	// The response ends the stream
+	if _, err := ReadTCPMessage(slow); err != io.EOF {
+		t.Errorf("reading after the response returned %v, expected io.EOF", err)
+	}
+}
+
+func TestServeQUICProtocolErrors(t *testing.T) {
+	var handled atomic.Int32
+	listener := startQUICServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Message) {
+		handled.Add(1)
+		_ = w.WriteMsg(NewResponse(r))
+	})})
+
+	truncated := binary.BigEndian.AppendUint16(nil, 40)
+	truncated = append(truncated, encodeQuery(t, 0, "example.com")[:HeaderSize]...)
+
+	tests := []struct {
+		description string
+		data        []byte
+	}{
+		{"non-zero message ID", append(binary.BigEndian.AppendUint16(nil, 29), encodeQuery(t, 7, "example.com")...)},
+		{"stream ending inside the query", truncated},
+		{"stream ending before the query", nil},
+	}
+
+	for _, test := range tests {
+		conn := listener.dial(t)
+		stream, err := conn.OpenStream(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Write(test.data); err != nil {
+			t.Fatal(err)
+		}
+		_ = stream.Close()
+
+		if code := conn.closeCode(t); code != DoQProtocolError {
+			t.Errorf("%s: connection closed with code %d, expected DOQ_PROTOCOL_ERROR", test.description, code)
+		}
+	}
+	if n := handled.Load(); n != 0 {
+		t.Errorf("handler was called %d times for invalid queries", n)
+	}
+}
+
+func TestServeQUICClosesIdleConnections(t *testing.T) {
+	listener := startQUICServer(t, &Server{IdleTimeout: 50 * time.Millisecond})
+	conn := listener.dial(t)
+
+	if code := conn.closeCode(t); code != DoQNoError {
+		t.Errorf("idle connection closed with code %d, expected DOQ_NO_ERROR", code)
+	}
+}
+
+func TestQUICTLSConfig(t *testing.T) {
+	base := &tls.Config{ServerName: "dns.example", NextProtos: []string{"dot"}}
+	config := QUICTLSConfig(base)
+
+	if config.ServerName != "dns.example" || config.MinVersion != tls.VersionTLS13 || len(config.NextProtos) != 1 || config.NextProtos[0] != DoQALPN {
+		t.Errorf("got TLS configuration %+v, expected TLS 1.3 and the doq protocol", config)
+	}
+	if base.NextProtos[0] != "dot" {
+		t.Error("QUICTLSConfig modified its argument")
+	}
+}
@@ -0,0 +1,365 @@
+package dns
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// MinUDPSize is the payload size every DNS client over UDP supports (RFC 1035 section 4.2.1).
+	MinUDPSize = 512
+
+	// DefaultEDNSUDPSize is the payload size advertised by this package, as recommended by DNS Flag Day 2020.
+	DefaultEDNSUDPSize = 1232
+
+	// RCodeBadVers is the extended response code for an unsupported EDNS version (RFC 6891 section 6.1.3).
+	RCodeBadVers = 16
+)
+
+// EDNSOption is a single option carried in the RDATA of the OPT pseudo-record (RFC 6891 section 6.1.2).
+//
+// Methods:
+//
+// - Code: Returns the option code assigned by IANA.
+//
+// - Marshal: Returns the option data, without the code and length prefix.
+//
+// - Unmarshal: Decodes the option data, without the code and length prefix.
+//
+// - String: Returns a human readable form of the option.
+type EDNSOption interface {
+	Code() uint16
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+	String() string
+}
+
+// EDNS option codes with a typed representation.
+const (
+	OptionCodeNSID    uint16 = 3
+	OptionCodeCookie  uint16 = 10
+	OptionCodePadding uint16 = 12
+)
+
+var (
+	optionRegistryMu sync.RWMutex
+	optionRegistry   = map[uint16]func() EDNSOption{
+		OptionCodeNSID:    func() EDNSOption { return &NSIDOption{} },
+		OptionCodeCookie:  func() EDNSOption { return &CookieOption{} },
+		OptionCodePadding: func() EDNSOption { return &PaddingOption{} },
+	}
+)
+
+// RegisterOption registers a constructor for the EDNS option with the given code.
+// Decoded OPT records use it to build the option instead of a RawOption. Registering a code
+// twice replaces the previous constructor, which allows overriding the built-in options.
+//
+// Parameters:
+// - code: The option code.
+// - factory: A function returning an empty option ready to be unmarshalled.
+func RegisterOption(code uint16, factory func() EDNSOption) {
+	optionRegistryMu.Lock()
+	defer optionRegistryMu.Unlock()
+	optionRegistry[code] = factory
+}
+
+// newOption returns an empty option for the given code, or a RawOption for unregistered codes.
+func newOption(code uint16) EDNSOption {
+	optionRegistryMu.RLock()
+	factory, ok := optionRegistry[code]
+	optionRegistryMu.RUnlock()
+
+	if !ok {
+		return &RawOption{OptionCode: code}
+	}
+	return factory()
+}
+
+// OPT is the RDATA of the OPT pseudo-record, a list of EDNS options.
+// The remaining EDNS fields live in the class and TTL of the record, see EDNS.
+type OPT struct {
+	Options []EDNSOption
+}
+
+func (r *OPT) Type() Type { return TypeOPT }
+
+func (r *OPT) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	for _, option := range r.Options {
+		data, err := option.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("EDNS option %d: %w", option.Code(), err)
+		}
+		if len(data) > 0xFFFF {
+			return nil, fmt.Errorf("EDNS option %d exceeds 65535 bytes", option.Code())
+		}
+
+		msg = binary.BigEndian.AppendUint16(msg, option.Code())
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(data)))
+		msg = append(msg, data...)
+	}
+	return msg, nil
+}
+
+func (r *OPT) Unmarshal(dnsMessage []byte, offset, length int) error {
+	r.Options = nil
+	end := offset + length
+
+	for offset < end {
+		if offset+4 > end {
+			return fmt.Errorf("%w: EDNS option header", ErrShortMessage)
+		}
+		code := binary.BigEndian.Uint16(dnsMessage[offset:])
+		optionLength := int(binary.BigEndian.Uint16(dnsMessage[offset+2:]))
+		offset += 4
+
+		if offset+optionLength > end {
+			return fmt.Errorf("%w: EDNS option %d", ErrShortMessage, code)
+		}
+
+		option := newOption(code)
+		if err := option.Unmarshal(dnsMessage[offset : offset+optionLength]); err != nil {
+			return fmt.Errorf("EDNS option %d: %w", code, err)
+		}
+		r.Options = append(r.Options, option)
+		offset += optionLength
+	}
+	return nil
+}
+
+func (r *OPT) String() string {
+	options := make([]string, len(r.Options))
+	for i, option := range r.Options {
+		options[i] = option.String()
+	}
+	return strings.Join(options, " ")
+}
+
+// EDNS holds the EDNS(0) information of a message as defined in RFC 6891.
+// It is a view of the OPT pseudo-record in the additional section, whose class carries
+// the UDP payload size and whose TTL carries the extended RCODE, the version and the flags.
+//
+// Fields:
+//
+// - UDPSize: The largest UDP payload the sender can reassemble. Values below 512 are treated as 512.
+//
+// - ExtendedRCode: The upper 8 bits of the 12 bit response code, the lower 4 bits live in the header.
+//
+// - Version: The EDNS version, only version 0 is defined.
+//
+// - DO: DNSSEC OK - the sender is able to accept DNSSEC records (RFC 3225).
+//
+// - Options: The EDNS options carried in the RDATA.
+type EDNS struct {
+	UDPSize       uint16
+	ExtendedRCode uint8
+	Version       uint8
+	DO            bool
+	Options       []EDNSOption
+}
+
+// EDNS returns the EDNS information of the message.
+//
+// Returns:
+// - A pointer to an EDNS struct decoded from the first OPT record of the additional section,
+// or nil if the message does not use EDNS.
+func (m *Message) EDNS() *EDNS {
+	for _, record := range m.Additional {
+		if record.Type != TypeOPT {
+			continue
+		}
+
+		edns := &EDNS{
+			UDPSize:       uint16(record.Class),
+			ExtendedRCode: uint8(record.TTL >> 24),
+			Version:       uint8(record.TTL >> 16),
+			DO:            record.TTL&(1<<15) != 0,
+		}
+		if opt, ok := record.RData.(*OPT); ok {
+			edns.Options = opt.Options
+		}
+		return edns
+	}
+	return nil
+}
+
+// SetEDNS replaces the OPT record of the additional section with one built from edns.
+// A nil edns removes the OPT record.
+//
+// Parameters:
+// - edns: The EDNS information to store in the message, or nil.
+func (m *Message) SetEDNS(edns *EDNS) {
+	additional := make([]Answer, 0, len(m.Additional)+1)
+	for _, record := range m.Additional {
+		if record.Type != TypeOPT {
+			additional = append(additional, record)
+		}
+	}
+
+	if edns != nil {
+		ttl := uint32(edns.ExtendedRCode)<<24 | uint32(edns.Version)<<16
+		if edns.DO {
+			ttl |= 1 << 15
+		}
+
+		additional = append(additional, Answer{
+			Name:  "",
+			Type:  TypeOPT,
+			Class: Class(max(edns.UDPSize, MinUDPSize)),
+			TTL:   ttl,
+			RData: &OPT{Options: edns.Options},
+		})
+	}
+
+	m.Additional = additional
+}
+
+// CheckEDNS checks a query against the EDNS rules of RFC 6891: a message carries at most one
+// OPT record (section 6.1.1), and version 0 is the only EDNS version this package implements (section 6.1.3).
+//
+// Parameters:
+// - query: The decoded query.
+//
+// Returns:
+// - RCodeFormatError for several OPT records, RCodeBadVers for an EDNS version above 0, RCodeSuccess otherwise.
+func CheckEDNS(query *Message) uint16 {
+	count := 0
+	for _, record := range query.Additional {
+		if record.Type == TypeOPT {
+			count++
+		}
+	}
+	if count > 1 {
+		return RCodeFormatError
+	}
+
+	if edns := query.EDNS(); edns != nil && edns.Version > 0 {
+		return RCodeBadVers
+	}
+	return RCodeSuccess
+}
+
+// UDPSize returns the largest UDP payload the sender of the message accepts:
+// the size advertised in its OPT record, or MinUDPSize without EDNS or for smaller advertised sizes.
+func (m *Message) UDPSize() int {
+	if edns := m.EDNS(); edns != nil {
+		return max(int(edns.UDPSize), MinUDPSize)
+	}
+	return MinUDPSize
+}
+
+// RCode returns the full 12 bit response code of the message,
+// combining the 4 bits of the header with the extended bits of the OPT record.
+func (m *Message) RCode() uint16 {
+	rcode := uint16(m.Header.RCode)
+	if edns := m.EDNS(); edns != nil {
+		rcode |= uint16(edns.ExtendedRCode) << 4
+	}
+	return rcode
+}
+
+// SetRCode stores a response code of up to 12 bits in the message.
+// The lower 4 bits go into the header. Codes above 15 need EDNS, so an OPT record is added
+// when the message does not carry one yet.
+//
+// Parameters:
+// - rcode: The response code to set.
+func (m *Message) SetRCode(rcode uint16) {
+	m.Header.RCode = uint8(rcode & 0xF)
+
+	edns := m.EDNS()
+	if edns == nil {
+		if rcode <= 0xF {
+			return
+		}
+		edns = &EDNS{UDPSize: DefaultEDNSUDPSize}
+	}
+	edns.ExtendedRCode = uint8(rcode >> 4)
+	m.SetEDNS(edns)
+}
+
+// NSIDOption carries the name server identifier (RFC 5001).
+// Queries send it empty to ask the server for its identifier.
+type NSIDOption struct {
+	ID []byte
+}
+
+func (o *NSIDOption) Code() uint16 { return OptionCodeNSID }
+
+func (o *NSIDOption) Marshal() ([]byte, error) { return o.ID, nil }
+
+func (o *NSIDOption) Unmarshal(data []byte) error {
+	o.ID = append([]byte(nil), data...)
+	return nil
+}
+
+func (o *NSIDOption) String() string { return "NSID=" + hex.EncodeToString(o.ID) }
+
+// CookieOption carries a DNS cookie (RFC 7873): an 8 byte client cookie
+// optionally followed by a server cookie of 8 to 32 bytes.
+type CookieOption struct {
+	Client []byte
+	Server []byte
+}
+
+func (o *CookieOption) Code() uint16 { return OptionCodeCookie }
+
+func (o *CookieOption) Marshal() ([]byte, error) {
+	if len(o.Client) != 8 {
+		return nil, fmt.Errorf("client cookie must be 8 bytes, got %d", len(o.Client))
+	}
+	if len(o.Server) != 0 && (len(o.Server) < 8 || len(o.Server) > 32) {
+		return nil, fmt.Errorf("server cookie must be between 8 and 32 bytes, got %d", len(o.Server))
+	}
+	return append(append([]byte(nil), o.Client...), o.Server...), nil
+}
+
+func (o *CookieOption) Unmarshal(data []byte) error {
+	if len(data) != 8 && (len(data) < 16 || len(data) > 40) {
+		return fmt.Errorf("invalid cookie length %d", len(data))
+	}
+	o.Client = append([]byte(nil), data[:8]...)
+	o.Server = append([]byte(nil), data[8:]...)
+	return nil
+}
+
+func (o *CookieOption) String() string {
+	return "COOKIE=" + hex.EncodeToString(o.Client) + hex.EncodeToString(o.Server)
+}
+
+// PaddingOption pads a message to a multiple of a block size to hide its length (RFC 7830).
+type PaddingOption struct {
+	Length int
+}
+
+func (o *PaddingOption) Code() uint16 { return OptionCodePadding }
+
+func (o *PaddingOption) Marshal() ([]byte, error) { return make([]byte, o.Length), nil }
+
+func (o *PaddingOption) Unmarshal(data []byte) error {
+	o.Length = len(data)
+	return nil
+}
+
+func (o *PaddingOption) String() string { return fmt.Sprintf("PADDING=%d", o.Length) }
+
+// RawOption holds the uninterpreted data of an option without a registered type.
+type RawOption struct {
+	OptionCode uint16
+	Data       []byte
+}
+
+func (o *RawOption) Code() uint16 { return o.OptionCode }
+
+func (o *RawOption) Marshal() ([]byte, error) { return o.Data, nil }
+
+func (o *RawOption) Unmarshal(data []byte) error {
+	o.Data = append([]byte(nil), data...)
+	return nil
+}
+
+func (o *RawOption) String() string {
+	return fmt.Sprintf("OPTION%d=%s", o.OptionCode, hex.EncodeToString(o.Data))
+}
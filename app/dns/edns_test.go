@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// ednsQuery returns a query for example.com carrying the EDNS information.
+func ednsQuery(edns *EDNS) *Message {
+	query := &Message{
+		Header:    Header{ID: 7, RD: true, QDCount: 1},
+		Questions: []Question{{Name: "example.com", Type: TypeA, Class: ClassIN}},
+	}
+	query.SetEDNS(edns)
+	return query
+}
+
+func TestEDNSMarshal(t *testing.T) {
+	query := ednsQuery(&EDNS{UDPSize: 4096, DO: true, Options: []EDNSOption{&NSIDOption{}}})
+	packet, err := query.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Root owner, type 41, class 4096, TTL with only the DO bit, RDLENGTH 4 and an empty NSID option
+	want, _ := hex.DecodeString("0000291000000080000004" + "00030000")
+	if !bytes.HasSuffix(packet, want) {
+		t.Errorf("OPT record encoded as %x, expected the message to end with %x", packet, want)
+	}
+	if packet[11] != 1 {
+		t.Errorf("ARCOUNT is %d, expected 1", packet[11])
+	}
+}
+
+func TestEDNSRoundTrip(t *testing.T) {
+	sent := &EDNS{
+		UDPSize:       1400,
+		ExtendedRCode: 1,
+		DO:            true,
+		Options: []EDNSOption{
+			&NSIDOption{ID: []byte("ns1")},
+			&CookieOption{Client: []byte("clientck"), Server: []byte("servercookie")},
+			&PaddingOption{Length: 5},
+			&RawOption{OptionCode: 65001, Data: []byte{1, 2}},
+		},
+	}
+	packet, err := ednsQuery(sent).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := UnMarshallMessage(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edns := message.EDNS()
+	if edns == nil {
+		t.Fatal("EDNS lost in the round trip")
+	}
+	if edns.UDPSize != 1400 || edns.ExtendedRCode != 1 || edns.Version != 0 || !edns.DO {
+		t.Errorf("decoded EDNS %+v, expected %+v", edns, sent)
+	}
+	if message.RCode() != 16 {
+		t.Errorf("decoded response code %d, expected 16", message.RCode())
+	}
+
+	if len(edns.Options) != len(sent.Options) {
+		t.Fatalf("decoded %d options, expected %d", len(edns.Options), len(sent.Options))
+	}
+	for i, option := range edns.Options {
+		if option.String() != sent.Options[i].String() {
+			t.Errorf("option %d decoded as %s, expected %s", i, option, sent.Options[i])
+		}
+	}
+	if cookie, ok := edns.Options[1].(*CookieOption); !ok || string(cookie.Server) != "servercookie" {
+		t.Errorf("cookie decoded as %#v", edns.Options[1])
+	}
+}
+
+func TestSetRCodeAddsEDNSForExtendedCodes(t *testing.T) {
+	message := &Message{}
+	message.SetRCode(RCodeBadVers)
+
+	edns := message.EDNS()
+	if edns == nil || edns.ExtendedRCode != 1 || message.Header.RCode != 0 {
+		t.Fatalf("BADVERS stored as header rcode %d and EDNS %+v", message.Header.RCode, edns)
+	}
+	if message.RCode() != RCodeBadVers {
+		t.Errorf("response code %d, expected %d", message.RCode(), RCodeBadVers)
+	}
+}
+
+func TestNewResponseEchoesEDNS(t *testing.T) {
+	response := NewResponse(ednsQuery(&EDNS{UDPSize: 4096, DO: true, Options: []EDNSOption{&NSIDOption{}}}))
+
+	edns := response.EDNS()
+	if edns == nil {
+		t.Fatal("response to an EDNS query without EDNS")
+	}
+	if edns.UDPSize != DefaultEDNSUDPSize || !edns.DO || edns.Version != 0 || len(edns.Options) != 0 {
+		t.Errorf("response EDNS %+v, expected our payload size, the DO bit and no options", edns)
+	}
+
+	if response := NewResponse(ednsQuery(nil)); response.EDNS() != nil {
+		t.Error("response to a query without EDNS carries an OPT record")
+	}
+	if response := NewResponse(ednsQuery(&EDNS{UDPSize: 4096})); response.EDNS().DO {
+		t.Error("response sets DO for a query without it")
+	}
+}
+
+func TestCheckEDNS(t *testing.T) {
+	twoOPT := ednsQuery(&EDNS{UDPSize: 4096})
+	twoOPT.Additional = append(twoOPT.Additional, twoOPT.Additional[0])
+
+	tests := []struct {
+		description string
+		query       *Message
+		rcode       uint16
+	}{
+		{"without EDNS", ednsQuery(nil), RCodeSuccess},
+		{"EDNS version 0", ednsQuery(&EDNS{UDPSize: 4096}), RCodeSuccess},
+		{"EDNS version 1", ednsQuery(&EDNS{UDPSize: 4096, Version: 1}), RCodeBadVers},
+		{"two OPT records", twoOPT, RCodeFormatError},
+	}
+
+	for _, test := range tests {
+		if rcode := CheckEDNS(test.query); rcode != test.rcode {
+			t.Errorf("%s: got rcode %d, expected %d", test.description, rcode, test.rcode)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package dns
+
+import "errors"
+
+// Errors returned when decoding or encoding malformed DNS messages.
+// They are wrapped with details about the failing field, so compare them with errors.Is.
+var (
+	// ErrShortHeader is returned when a message is shorter than the 12 byte header.
+	ErrShortHeader = errors.New("message shorter than the DNS header")
+
+	// ErrShortMessage is returned when a message ends in the middle of a name, question or record.
+	ErrShortMessage = errors.New("message ends unexpectedly")
+
+	// ErrPointerLoop is returned when the compression pointers of a name form a loop.
+	ErrPointerLoop = errors.New("compression pointer loop")
+
+	// ErrLabelTooLong is returned when a label exceeds 63 bytes.
+	ErrLabelTooLong = errors.New("label exceeds 63 bytes")
+
+	// ErrNameTooLong is returned when the wire form of a name exceeds 255 bytes.
+	ErrNameTooLong = errors.New("name exceeds 255 bytes")
+
+	// ErrTrailingData is returned when bytes remain after the last record declared in the header.
+	ErrTrailingData = errors.New("trailing data after the last record")
+)
+
+const (
+	maxLabelLength = 63
+	maxNameLength  = 255
+)
@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+)
+
+// Handler responds to a DNS query.
+//
+// ServeDNS should write a response with the ResponseWriter and then return.
+// A handler which returns without writing leaves the client waiting until it times out.
+type Handler interface {
+	ServeDNS(w ResponseWriter, r *Message)
+}
+
+// HandlerFunc adapts an ordinary function to the Handler interface.
+type HandlerFunc func(w ResponseWriter, r *Message)
+
+// ServeDNS calls f(w, r).
+func (f HandlerFunc) ServeDNS(w ResponseWriter, r *Message) {
+	f(w, r)
+}
+
+// ResponseWriter is used by a Handler to answer the query it is serving.
+//
+// Methods:
+//
+// - LocalAddr: Returns the address the query was received on.
+//
+// - RemoteAddr: Returns the address of the client.
+//
+// - Network: Returns the transport the query arrived over, such as "udp" or "tcp".
+//
+// - WriteMsg: Encodes and sends the response to the client.
+type ResponseWriter interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	Network() string
+	WriteMsg(m *Message) error
+}
+
+// RCodeHandler returns a Handler which answers every query with an empty response carrying rcode.
+//
+// Parameters:
+// - rcode: The response code to answer with, such as RCodeRefused.
+//
+// Returns:
+// - A Handler writing the response.
+func RCodeHandler(rcode uint16) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Message) {
+		response := NewResponse(r)
+		response.SetRCode(rcode)
+		if err := w.WriteMsg(response); err != nil {
+			fmt.Println("Failed to send response:", err)
+		}
+	})
+}
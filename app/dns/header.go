@@ -10,6 +10,16 @@ const (
 	HeaderSize = 12
 )
 
+// Response codes carried in the RCode field of the header (RFC 1035 section 4.1.1).
+const (
+	RCodeSuccess        = 0
+	RCodeFormatError    = 1
+	RCodeServerFailure  = 2
+	RCodeNameError      = 3
+	RCodeNotImplemented = 4
+	RCodeRefused        = 5
+)
+
 // Header represents the DNS packet header as defined in RFC 1035.
 // The DNS header is 12 bytes long and contains various fields that
 // provide information about the DNS query or response.
@@ -34,7 +44,12 @@ const (
 //
 // - RA: Recursion Available - this bit is set or cleared in a response, and denotes whether recursive query support is available in the name server.
 //
-// - Z: Reserved for future use. Must be zero in all queries and responses.
+// - Z: The one reserved bit left by RFC 4035. Must be zero in all queries and responses.
+//
+// - AD: Authentic Data - in responses, the server verified every record of the answer and authority sections with DNSSEC (RFC 4035 section 3.2.3).
+// In queries, the client asks for the bit to be set (RFC 6840 section 5.7).
+//
+// - CD: Checking Disabled - in queries, the client accepts data the server did not verify with DNSSEC. It is copied into the response.
 //
 // - RCode: Response code - this 4-bit field is set as part of responses. The following values are defined:
 //   - 0: No error condition
@@ -52,6 +67,8 @@ const (
 // - NSCount: An unsigned 16-bit integer specifying the number of name server resource records in the authority records section.
 //
 // - ARCount: An unsigned 16-bit integer specifying the number of resource records in the additional records section.
+//
+// Message.Marshal derives the four counts from the sections of the message.
 type Header struct {
 	ID      uint16
 	QR      bool
@@ -61,6 +78,8 @@ type Header struct {
 	RD      bool
 	RA      bool
 	Z       uint8
+	AD      bool
+	CD      bool
 	RCode   uint8
 	QDCount uint16
 	ANCount uint16
@@ -87,10 +106,16 @@ func (h *Header) Marshal() []byte {
 		encoded[2] |= 1
 	}
 
-	encoded[3] = h.Z << 4
+	encoded[3] = (h.Z & 1) << 6
 	if h.RA {
 		encoded[3] |= 1 << 7
 	}
+	if h.AD {
+		encoded[3] |= 1 << 5
+	}
+	if h.CD {
+		encoded[3] |= 1 << 4
+	}
 	encoded[3] |= h.RCode & 0xF
 
 	binary.BigEndian.PutUint16(encoded[4:6], h.QDCount)
@@ -102,14 +127,20 @@ func (h *Header) Marshal() []byte {
 }
 
 // UnmarshalHeader decodes a byte slice into a DNS Header struct.
-// The byte slice should be 12 bytes long, as per the DNS header specification.
+// The byte slice should be at least 12 bytes long, as per the DNS header specification.
+// Only the first 12 bytes are read.
 //
 // Parameters:
 // - encoded: A byte slice containing the encoded DNS header.
 //
 // Returns:
 // - A pointer to a Header struct populated with the decoded values.
-func UnmarshalHeader(encoded []byte) *Header {
+// - ErrShortHeader if the byte slice is shorter than the header.
+func UnmarshalHeader(encoded []byte) (*Header, error) {
+	if len(encoded) < HeaderSize {
+		return nil, fmt.Errorf("%w: got %d bytes", ErrShortHeader, len(encoded))
+	}
+
 	return &Header{
 		ID:      binary.BigEndian.Uint16(encoded[0:2]),
 		QR:      encoded[2]&(1<<7) != 0,
@@ -118,13 +149,15 @@ func UnmarshalHeader(encoded []byte) *Header {
 		TC:      encoded[2]&(1<<1) != 0,
 		RD:      encoded[2]&1 != 0,
 		RA:      encoded[3]&(1<<7) != 0,
-		Z:       (encoded[3] >> 4) & 0x7,
+		Z:       (encoded[3] >> 6) & 1,
+		AD:      encoded[3]&(1<<5) != 0,
+		CD:      encoded[3]&(1<<4) != 0,
 		RCode:   encoded[3] & 0xF,
 		QDCount: binary.BigEndian.Uint16(encoded[4:6]),
 		ANCount: binary.BigEndian.Uint16(encoded[6:8]),
 		NSCount: binary.BigEndian.Uint16(encoded[8:10]),
 		ARCount: binary.BigEndian.Uint16(encoded[10:12]),
-	}
+	}, nil
 }
 
 func (h *Header) String() string {
@@ -137,7 +170,9 @@ func (h *Header) String() string {
 	result.WriteString(fmt.Sprintf("TC:      %t (%01b)\n", h.TC, boolToBit(h.TC)))
 	result.WriteString(fmt.Sprintf("RD:      %t (%01b)\n", h.RD, boolToBit(h.RD)))
 	result.WriteString(fmt.Sprintf("RA:      %t (%01b)\n", h.RA, boolToBit(h.RA)))
-	result.WriteString(fmt.Sprintf("Z:       %d (%03b)\n", h.Z, h.Z))
+	result.WriteString(fmt.Sprintf("Z:       %d (%01b)\n", h.Z, h.Z))
+	result.WriteString(fmt.Sprintf("AD:      %t (%01b)\n", h.AD, boolToBit(h.AD)))
+	result.WriteString(fmt.Sprintf("CD:      %t (%01b)\n", h.CD, boolToBit(h.CD)))
 	result.WriteString(fmt.Sprintf("RCode:   %d (%04b)\n", h.RCode, h.RCode))
 	result.WriteString(fmt.Sprintf("QDCount: %d (%016b)\n", h.QDCount, h.QDCount))
 	result.WriteString(fmt.Sprintf("ANCount: %d (%016b)\n", h.ANCount, h.ANCount))
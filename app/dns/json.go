@@ -0,0 +1,280 @@
+package dns
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonFlag is a header bit in the JSON representation of a message. RFC 8427 describes the bits
+// as Boolean while its examples write them as 0 and 1, so both forms are read and 0 or 1 is written.
+type jsonFlag bool
+
+func (f jsonFlag) MarshalJSON() ([]byte, error) {
+	if f {
+		return []byte("1"), nil
+	}
+	return []byte("0"), nil
+}
+
+func (f *jsonFlag) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "1", "true":
+		*f = true
+	case "0", "false", "null":
+		*f = false
+	default:
+		return fmt.Errorf("invalid flag %s, expected 0, 1, true or false", data)
+	}
+	return nil
+}
+
+// jsonMessage is the JSON representation of a message defined by RFC 8427.
+type jsonMessage struct {
+	ID      uint16   `json:"ID"`
+	QR      jsonFlag `json:"QR"`
+	Opcode  uint8    `json:"Opcode"`
+	AA      jsonFlag `json:"AA"`
+	TC      jsonFlag `json:"TC"`
+	RD      jsonFlag `json:"RD"`
+	RA      jsonFlag `json:"RA"`
+	AD      jsonFlag `json:"AD"`
+	CD      jsonFlag `json:"CD"`
+	RCODE   uint8    `json:"RCODE"`
+	QDCOUNT uint16   `json:"QDCOUNT"`
+	ANCOUNT uint16   `json:"ANCOUNT"`
+	NSCOUNT uint16   `json:"NSCOUNT"`
+	ARCOUNT uint16   `json:"ARCOUNT"`
+
+	QNAME      *string `json:"QNAME,omitempty"`
+	QTYPE      *uint16 `json:"QTYPE,omitempty"`
+	QTYPEname  string  `json:"QTYPEname,omitempty"`
+	QCLASS     *uint16 `json:"QCLASS,omitempty"`
+	QCLASSname string  `json:"QCLASSname,omitempty"`
+
+	AnswerRRs     []jsonRecord `json:"answerRRs,omitempty"`
+	AuthorityRRs  []jsonRecord `json:"authorityRRs,omitempty"`
+	AdditionalRRs []jsonRecord `json:"additionalRRs,omitempty"`
+}
+
+// jsonRecord is the JSON representation of a resource record defined by RFC 8427 section 2.2.
+// The record data is written in one of the type specific members, or as hexadecimal wire format.
+type jsonRecord struct {
+	NAME       string  `json:"NAME"`
+	TYPE       uint16  `json:"TYPE"`
+	TYPEname   string  `json:"TYPEname,omitempty"`
+	CLASS      uint16  `json:"CLASS"`
+	CLASSname  string  `json:"CLASSname,omitempty"`
+	TTL        uint32  `json:"TTL"`
+	RDLENGTH   *uint16 `json:"RDLENGTH,omitempty"`
+	RdataHEX   string  `json:"rdataHEX,omitempty"`
+	RdataA     string  `json:"rdataA,omitempty"`
+	RdataAAAA  string  `json:"rdataAAAA,omitempty"`
+	RdataCNAME string  `json:"rdataCNAME,omitempty"`
+	RdataNS    string  `json:"rdataNS,omitempty"`
+	RdataPTR   string  `json:"rdataPTR,omitempty"`
+}
+
+// MarshalJSON encodes the message as a JSON object following RFC 8427.
+// The header fields, the first question and the three record sections are written. The record data
+// of A, AAAA, CNAME, NS and PTR records uses the type specific members, every other type is written
+// as hexadecimal wire format in rdataHEX.
+//
+// Returns:
+// - The JSON encoding of the message.
+// - An error if the data of a record cannot be encoded.
+func (m *Message) MarshalJSON() ([]byte, error) {
+	encoded := jsonMessage{
+		ID:      m.Header.ID,
+		QR:      jsonFlag(m.Header.QR),
+		Opcode:  m.Header.OpCode,
+		AA:      jsonFlag(m.Header.AA),
+		TC:      jsonFlag(m.Header.TC),
+		RD:      jsonFlag(m.Header.RD),
+		RA:      jsonFlag(m.Header.RA),
+		AD:      jsonFlag(m.Header.AD),
+		CD:      jsonFlag(m.Header.CD),
+		RCODE:   m.Header.RCode,
+		QDCOUNT: uint16(len(m.Questions)),
+		ANCOUNT: uint16(len(m.Answers)),
+		NSCOUNT: uint16(len(m.Authority)),
+		ARCOUNT: uint16(len(m.Additional)),
+	}
+
+	if len(m.Questions) > 0 {
+		question := m.Questions[0]
+		name, qtype, qclass := FQDN(question.Name), uint16(question.Type), uint16(question.Class)
+		encoded.QNAME = &name
+		encoded.QTYPE = &qtype
+		encoded.QTYPEname = question.Type.String()
+		encoded.QCLASS = &qclass
+		encoded.QCLASSname = question.Class.String()
+	}
+
+	var err error
+	if encoded.AnswerRRs, err = recordsToJSON(m.Answers); err != nil {
+		return nil, err
+	}
+	if encoded.AuthorityRRs, err = recordsToJSON(m.Authority); err != nil {
+		return nil, err
+	}
+	if encoded.AdditionalRRs, err = recordsToJSON(m.Additional); err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a message from its RFC 8427 JSON representation, as written by MarshalJSON.
+// The count members are ignored, since the counts follow from the sections. Record data is read
+// from the type specific members or from rdataHEX.
+//
+// Parameters:
+// - data: The JSON object to decode.
+//
+// Returns:
+// - An error if the JSON is malformed or a record lacks valid data.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var decoded jsonMessage
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	message := Message{
+		Header: Header{
+			ID:     decoded.ID,
+			QR:     bool(decoded.QR),
+			OpCode: decoded.Opcode & 0xF,
+			AA:     bool(decoded.AA),
+			TC:     bool(decoded.TC),
+			RD:     bool(decoded.RD),
+			RA:     bool(decoded.RA),
+			AD:     bool(decoded.AD),
+			CD:     bool(decoded.CD),
+			RCode:  decoded.RCODE & 0xF,
+		},
+	}
+
+	if decoded.QNAME != nil {
+		name, err := QualifyName(*decoded.QNAME, "")
+		if err != nil {
+			return fmt.Errorf("QNAME: %w", err)
+		}
+		question := Question{Name: name, Type: TypeA, Class: ClassIN}
+		if decoded.QTYPE != nil {
+			question.Type = Type(*decoded.QTYPE)
+		}
+		if decoded.QCLASS != nil {
+			question.Class = Class(*decoded.QCLASS)
+		}
+		message.Questions = []Question{question}
+	}
+
+	var err error
+	if message.Answers, err = recordsFromJSON(decoded.AnswerRRs); err != nil {
+		return fmt.Errorf("answerRRs: %w", err)
+	}
+	if message.Authority, err = recordsFromJSON(decoded.AuthorityRRs); err != nil {
+		return fmt.Errorf("authorityRRs: %w", err)
+	}
+	if message.Additional, err = recordsFromJSON(decoded.AdditionalRRs); err != nil {
+		return fmt.Errorf("additionalRRs: %w", err)
+	}
+
+	*m = message
+	return nil
+}
+
+// recordsToJSON converts the records of a section to their JSON representation.
+func recordsToJSON(records []Answer) ([]jsonRecord, error) {
+	encoded := make([]jsonRecord, len(records))
+	for i, record := range records {
+		// A record without data is written as empty wire data, like Answer.Marshal does
+		var data []byte
+		if record.RData != nil {
+			var err error
+			if data, err = record.RData.Marshal(nil, nil); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", record.Name, record.Type, err)
+			}
+		}
+		rdLength := uint16(len(data))
+
+		encoded[i] = jsonRecord{
+			NAME:      FQDN(record.Name),
+			TYPE:      uint16(record.Type),
+			TYPEname:  record.Type.String(),
+			CLASS:     uint16(record.Class),
+			CLASSname: record.Class.String(),
+			TTL:       record.TTL,
+			RDLENGTH:  &rdLength,
+		}
+
+		switch rdata := record.RData.(type) {
+		case *A:
+			encoded[i].RdataA = rdata.String()
+		case *AAAA:
+			encoded[i].RdataAAAA = rdata.String()
+		case *CNAME:
+			encoded[i].RdataCNAME = rdata.String()
+		case *NS:
+			encoded[i].RdataNS = rdata.String()
+		case *PTR:
+			encoded[i].RdataPTR = rdata.String()
+		default:
+			encoded[i].RdataHEX = hex.EncodeToString(data)
+		}
+	}
+	return encoded, nil
+}
+
+// recordsFromJSON converts the JSON representation of the records of a section back to records.
+func recordsFromJSON(encoded []jsonRecord) ([]Answer, error) {
+	records := make([]Answer, 0, len(encoded))
+	for _, record := range encoded {
+		rrType := Type(record.TYPE)
+
+		var typed string
+		switch rrType {
+		case TypeA:
+			typed = record.RdataA
+		case TypeAAAA:
+			typed = record.RdataAAAA
+		case TypeCNAME:
+			typed = record.RdataCNAME
+		case TypeNS:
+			typed = record.RdataNS
+		case TypePTR:
+			typed = record.RdataPTR
+		}
+
+		var rdata RData
+		var err error
+		switch {
+		case typed != "":
+			rdata, err = ParseRData(rrType, []string{typed}, "")
+		case record.RdataHEX != "" || record.RDLENGTH != nil && *record.RDLENGTH == 0:
+			var data []byte
+			if data, err = hex.DecodeString(record.RdataHEX); err == nil {
+				rdata = newRData(rrType)
+				err = rdata.Unmarshal(data, 0, len(data))
+			}
+		default:
+			err = fmt.Errorf("no record data")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", record.NAME, rrType, err)
+		}
+
+		name, err := QualifyName(record.NAME, "")
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, Answer{
+			Name:  name,
+			Type:  rrType,
+			Class: Class(record.CLASS),
+			TTL:   record.TTL,
+			RData: rdata,
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+// jsonTestMessage returns a response using every record type, one of them without record data.
+func jsonTestMessage() *Message {
+	record := func(name string, rrType Type, rdata RData) Answer {
+		return Answer{Name: name, Type: rrType, Class: ClassIN, TTL: 300, RData: rdata}
+	}
+
+	message := &Message{
+		Header:    Header{ID: 0xBEEF, QR: true, AA: true, RD: true, RA: true, AD: true, RCode: RCodeSuccess},
+		Questions: []Question{{Name: "www.example.com", Type: TypeA, Class: ClassIN}},
+		Answers: []Answer{
+			record("www.example.com", TypeCNAME, &CNAME{Target: "web.example.com"}),
+			record("web.example.com", TypeA, &A{IP: net.IPv4(192, 0, 2, 1).To4()}),
+			record("web.example.com", TypeAAAA, &AAAA{IP: net.ParseIP("2001:db8::1")}),
+			record("example.com", TypeMX, &MX{Preference: 10, Exchange: "mail.example.com"}),
+			record("example.com", TypeTXT, &TXT{Text: []string{"v=spf1 -all", `say "hi"`}}),
+			record("1.2.0.192.in-addr.arpa", TypePTR, &PTR{Ptr: "web.example.com"}),
+			record("_sip._udp.example.com", TypeSRV, &SRV{Priority: 1, Weight: 2, Port: 5060, Target: "sip.example.com"}),
+			record("example.com", TypeCAA, &CAA{Tag: "issue", Value: "ca.example.net"}),
+			record("example.com", Type(999), &RawRData{RRType: Type(999), Data: []byte{0xDE, 0xAD}}),
+			record("empty.example.com", TypeTXT, nil),
+		},
+		Authority: []Answer{
+			record("example.com", TypeNS, &NS{Host: "ns1.example.com"}),
+			record("example.com", TypeSOA, &SOA{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 1, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300}),
+		},
+	}
+	message.SetEDNS(&EDNS{UDPSize: 1232, DO: true, Options: []EDNSOption{&NSIDOption{ID: []byte("test")}}})
+	return message
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	message := jsonTestMessage()
+	want, err := message.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got, err := decoded.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("wire format changed after a JSON round trip\n got: %x\nwant: %x\nJSON: %s", got, want, encoded)
+	}
+}
+
+func TestMarshalJSONRecordWithoutData(t *testing.T) {
+	encoded, err := json.Marshal(jsonTestMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		AnswerRRs []map[string]any `json:"answerRRs"`
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	empty := decoded.AnswerRRs[len(decoded.AnswerRRs)-1]
+	if empty["NAME"] != "empty.example.com." || empty["RDLENGTH"] != float64(0) {
+		t.Errorf("record without data encoded as %v, expected RDLENGTH 0", empty)
+	}
+	if _, ok := empty["rdataHEX"]; ok {
+		t.Errorf("record without data encoded as %v, expected no rdataHEX", empty)
+	}
+}
+
+func TestUnmarshalJSONExample(t *testing.T) {
+	// The query of RFC 8427 section 5.1
+	example := `{ "ID": 19678, "QR": 0, "Opcode": 0, "AA": 0, "TC": 0, "RD": 0, "RA": 0,
+		"AD": 0, "CD": 0, "RCODE": 0, "QDCOUNT": 1, "ANCOUNT": 0, "NSCOUNT": 0, "ARCOUNT": 0,
+		"QNAME": "example.com", "QTYPE": 1, "QCLASS": 1 }`
+
+	var message Message
+	if err := json.Unmarshal([]byte(example), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Header.ID != 19678 || message.Header.QR || len(message.Questions) != 1 {
+		t.Fatalf("decoded header %+v with %d questions", message.Header, len(message.Questions))
+	}
+	if question := message.Questions[0]; question.Name != "example.com" || question.Type != TypeA || question.Class != ClassIN {
+		t.Errorf("decoded question %+v, expected example.com A IN", question)
+	}
+}
@@ -1,38 +1,100 @@
 package dns
 
+import "fmt"
+
+// Message represents a complete DNS message as defined in RFC 1035.
+//
+// Fields:
+//
+// - Header: The fixed 12 byte header of the message. Its section counts are derived from the
+// section slices when the message is marshalled, so callers never set them.
+//
+// - Questions: The entries of the question section.
+//
+// - Answers: The resource records of the answer section.
+//
+// - Authority: The resource records of the authority section, pointing toward an authoritative name server.
+//
+// - Additional: The resource records of the additional section, holding records which relate to the query
+// but are not strictly answers for the question.
 type Message struct {
-	Header    Header
-	Questions []Question
-	Answers   []Answer
+	Header     Header
+	Questions  []Question
+	Answers    []Answer
+	Authority  []Answer
+	Additional []Answer
 }
 
 // Marshal encodes the DNS Message into a byte slice.
-// It marshals the Header, Question, and Answer fields of the Message
+// It marshals the Header followed by the question, answer, authority and additional sections
 // and concatenates their byte representations into a single byte slice.
+// Domain names are compressed across all sections as described in RFC 1035 section 4.1.4.
+// The QDCOUNT, ANCOUNT, NSCOUNT and ARCOUNT fields of the header are taken from the lengths of the sections.
 //
 // Returns:
 // - A byte slice containing the encoded DNS Message.
-func (m *Message) Marshal() []byte {
-	var encoded []byte
-	encodedHeader := m.Header.Marshal()
-	encoded = append(encoded, encodedHeader...)
+// - An error if any question or record cannot be encoded or a section holds more than 65535 entries.
+func (m *Message) Marshal() ([]byte, error) {
+	return m.marshal(make(map[string]int))
+}
+
+// MarshalUncompressed encodes the DNS Message like Marshal but writes every domain name in full.
+// This makes the output easy to compare byte for byte while debugging.
+//
+// Returns:
+// - A byte slice containing the encoded DNS Message.
+// - An error if any question or record cannot be encoded.
+func (m *Message) MarshalUncompressed() ([]byte, error) {
+	return m.marshal(nil)
+}
+
+// marshal encodes the message using the given compression table, which is nil to disable compression.
+func (m *Message) marshal(compression map[string]int) ([]byte, error) {
+	header := m.Header
+	sections := []struct {
+		name   string
+		length int
+		count  *uint16
+	}{
+		{"question", len(m.Questions), &header.QDCount},
+		{"answer", len(m.Answers), &header.ANCount},
+		{"authority", len(m.Authority), &header.NSCount},
+		{"additional", len(m.Additional), &header.ARCount},
+	}
+	for _, section := range sections {
+		if section.length > 0xFFFF {
+			return nil, fmt.Errorf("%s section holds %d entries, at most 65535 fit in the header", section.name, section.length)
+		}
+		*section.count = uint16(section.length)
+	}
+
+	encoded := header.Marshal()
 
 	for _, quest := range m.Questions {
-		encodedQuestion, _ := quest.Marshal()
-		encoded = append(encoded, encodedQuestion...)
+		var err error
+		encoded, err = quest.marshalTo(encoded, compression)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	for _, ans := range m.Answers {
-		encodedAnswer := ans.Marshal()
-		encoded = append(encoded, encodedAnswer...)
+	for _, section := range [][]Answer{m.Answers, m.Authority, m.Additional} {
+		for _, ans := range section {
+			var err error
+			encoded, err = ans.marshalTo(encoded, compression)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	return encoded
+	return encoded, nil
 }
 
 // UnMarshallMessage decodes a byte slice into a DNS Message struct.
-// It unmarshal the Header and Question fields from the encoded byte slice
-// and sets default values for the Answer field and some Header fields.
+// It decodes the Header, the question section and the answer, authority and additional
+// sections exactly as they appear on the wire. The record counts in the header are checked
+// against the records that are actually present in the message.
 //
 // Parameters:
 // - encoded: A byte slice containing the encoded DNS message.
@@ -41,31 +103,78 @@ func (m *Message) Marshal() []byte {
 // - A pointer to a Message struct populated with the decoded values.
 // - An error if any issue occurs during decoding.
 func UnMarshallMessage(encoded []byte) (*Message, error) {
-	header := UnmarshalHeader(encoded)
-	questions, err := UnmarshalQuestions(encoded, header.QDCount)
+	header, err := UnmarshalHeader(encoded)
+	if err != nil {
+		return nil, err
+	}
 
+	questions, offset, err := unmarshalQuestions(encoded, HeaderSize, header.QDCount)
 	if err != nil {
 		return nil, err
 	}
 
-	answers := make([]Answer, 0, len(questions))
-	for _, quest := range questions {
-		answer := FromQuestion(quest)
-		answers = append(answers, answer)
+	answers, offset, err := unmarshalAnswers(encoded, offset, header.ANCount)
+	if err != nil {
+		return nil, fmt.Errorf("answer section: %w", err)
+	}
+
+	authority, offset, err := unmarshalAnswers(encoded, offset, header.NSCount)
+	if err != nil {
+		return nil, fmt.Errorf("authority section: %w", err)
 	}
 
-	header.QR = true
-	header.ANCount = uint16(len(answers))
+	additional, offset, err := unmarshalAnswers(encoded, offset, header.ARCount)
+	if err != nil {
+		return nil, fmt.Errorf("additional section: %w", err)
+	}
 
-	if header.OpCode == 0 {
-		header.RCode = 0
-	} else {
-		header.RCode = 4
+	if offset != len(encoded) {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTrailingData, len(encoded)-offset)
 	}
 
 	return &Message{
-		Header:    *header,
-		Questions: questions,
-		Answers:   answers,
+		Header:     *header,
+		Questions:  questions,
+		Answers:    answers,
+		Authority:  authority,
+		Additional: additional,
 	}, nil
 }
+
+// NewResponse builds an empty response to the given query.
+// The response copies the ID, OpCode, RD and CD bits and the questions of the query and sets the QR bit.
+// Queries with an OpCode other than a standard query (0) are answered with RCode 4 (Not Implemented).
+// If the query uses EDNS, the response carries an OPT record advertising DefaultEDNSUDPSize
+// and echoing the DO bit.
+//
+// Parameters:
+// - query: The query to respond to.
+//
+// Returns:
+// - A pointer to a Message struct with no records, ready to be filled in by the caller.
+func NewResponse(query *Message) *Message {
+	header := Header{
+		ID:     query.Header.ID,
+		QR:     true,
+		OpCode: query.Header.OpCode,
+		RD:     query.Header.RD,
+		CD:     query.Header.CD,
+	}
+
+	if header.OpCode != 0 {
+		header.RCode = RCodeNotImplemented
+	}
+
+	questions := make([]Question, len(query.Questions))
+	copy(questions, query.Questions)
+
+	response := &Message{
+		Header:    header,
+		Questions: questions,
+	}
+
+	if edns := query.EDNS(); edns != nil {
+		response.SetEDNS(&EDNS{UDPSize: DefaultEDNSUDPSize, DO: edns.DO})
+	}
+	return response
+}
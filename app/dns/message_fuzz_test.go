@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// fuzzSeed is a real response for example.com A, with a compressed answer name.
+const fuzzSeed = "abcd81800001000100000000076578616d706c6503636f6d0000010001c00c000100010000003c00045db8d822"
+
+func seedFuzz(f *testing.F) []byte {
+	seed, err := hex.DecodeString(fuzzSeed)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(seed)
+	f.Add(seed[:HeaderSize])
+	f.Add([]byte{})
+	return seed
+}
+
+func FuzzUnmarshalHeader(f *testing.F) {
+	seedFuzz(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := UnmarshalHeader(data)
+		if err != nil {
+			return
+		}
+		if encoded := header.Marshal(); !bytes.Equal(encoded, data[:HeaderSize]) {
+			t.Fatalf("header round trip changed %x to %x", data[:HeaderSize], encoded)
+		}
+	})
+}
+
+func FuzzUnmarshalQuestions(f *testing.F) {
+	seedFuzz(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := UnmarshalHeader(data)
+		if err != nil {
+			return
+		}
+		questions, err := UnmarshalQuestions(data, header.QDCount)
+		if err != nil {
+			return
+		}
+
+		encoded, err := (&Message{Questions: questions}).Marshal()
+		if err != nil {
+			return
+		}
+		decoded, err := UnmarshalQuestions(encoded, uint16(len(questions)))
+		if err != nil {
+			t.Fatalf("re-encoded questions %x do not decode: %v", encoded, err)
+		}
+		reencoded, err := (&Message{Questions: decoded}).Marshal()
+		if err != nil || !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("question round trip changed %x to %x (%v)", encoded, reencoded, err)
+		}
+	})
+}
+
+func FuzzUnMarshallMessage(f *testing.F) {
+	seedFuzz(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		message, err := UnMarshallMessage(data)
+		if err != nil {
+			return
+		}
+
+		encoded, err := message.Marshal()
+		if err != nil {
+			return
+		}
+		decoded, err := UnMarshallMessage(encoded)
+		if err != nil {
+			t.Fatalf("re-encoded message %x does not decode: %v", encoded, err)
+		}
+		reencoded, err := decoded.Marshal()
+		if err != nil || !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("message round trip changed %x to %x (%v)", encoded, reencoded, err)
+		}
+	})
+}
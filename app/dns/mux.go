@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+)
+
+// ServeMux is a DNS query multiplexer.
+// It matches the name of the question of each query against a list of registered zones
+// and calls the handler of the longest zone the name belongs to. The zone "." matches every name.
+//
+// Queries which do not carry exactly one question are answered with FORMERR, queries with an OpCode
+// other than a standard query with NOTIMP and queries for names outside every registered zone with REFUSED.
+type ServeMux struct {
+	mu    sync.RWMutex
+	zones map[string]Handler
+}
+
+// NewServeMux allocates and returns a new, empty ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{zones: make(map[string]Handler)}
+}
+
+// Handle registers the handler for the given zone, replacing any handler registered before.
+//
+// Parameters:
+// - zone: The zone apex, such as "example.com" or "." for every name.
+// - handler: The handler serving names inside the zone.
+func (mux *ServeMux) Handle(zone string, handler Handler) {
+	if handler == nil {
+		panic("dns: nil handler for zone " + zone)
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.zones[CanonicalName(zone)] = handler
+}
+
+// HandleFunc registers the handler function for the given zone, see Handle.
+func (mux *ServeMux) HandleFunc(zone string, handler func(w ResponseWriter, r *Message)) {
+	mux.Handle(zone, HandlerFunc(handler))
+}
+
+// Handler returns the handler of the longest registered zone containing name.
+//
+// Parameters:
+// - name: The domain name to look up.
+//
+// Returns:
+// - The matching Handler, or nil if no registered zone contains the name.
+func (mux *ServeMux) Handler(name string) Handler {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	name = CanonicalName(name)
+	for {
+		if handler, ok := mux.zones[name]; ok {
+			return handler
+		}
+		if name == "" {
+			return nil
+		}
+
+		dot := strings.IndexByte(name, '.')
+		if dot < 0 {
+			name = ""
+		} else {
+			name = name[dot+1:]
+		}
+	}
+}
+
+// ServeDNS dispatches the query to the handler of the zone of its question.
+func (mux *ServeMux) ServeDNS(w ResponseWriter, r *Message) {
+	if r.Header.OpCode != 0 {
+		RCodeHandler(RCodeNotImplemented).ServeDNS(w, r)
+		return
+	}
+	if len(r.Questions) != 1 {
+		RCodeHandler(RCodeFormatError).ServeDNS(w, r)
+		return
+	}
+
+	handler := mux.Handler(r.Questions[0].Name)
+	if handler == nil {
+		handler = RCodeHandler(RCodeRefused)
+	}
+	handler.ServeDNS(w, r)
+}
@@ -0,0 +1,303 @@
+package dns
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// QualifyName turns a domain name as written in a zone file into an absolute name.
+// Names ending with a dot are already absolute, "@" stands for the origin and
+// every other name is relative to the origin. Escapes are decoded as described by Unescape.
+// Names are kept as dot separated strings, so a dot inside a label, such as `a\.b` or `a\046b`,
+// cannot be represented and is rejected; an escaped trailing dot therefore never makes a name absolute.
+//
+// Parameters:
+// - name: The name to qualify.
+// - origin: The name relative names are appended to, without escapes.
+//
+// Returns:
+// - The absolute name without the trailing dot, "" for the root.
+// - An error if the name contains a malformed escape or an escaped dot.
+func QualifyName(name, origin string) (string, error) {
+	origin = strings.TrimSuffix(origin, ".")
+	if name == "@" {
+		return origin, nil
+	}
+
+	// A trailing dot is escaped if an odd number of backslashes precedes it
+	absolute := false
+	if strings.HasSuffix(name, ".") {
+		backslashes := len(name) - 1 - len(strings.TrimRight(name[:len(name)-1], "\\"))
+		absolute = backslashes%2 == 0
+		if absolute {
+			name = name[:len(name)-1]
+		}
+	}
+
+	decoded, err := unescape(name, true)
+	if err != nil {
+		return "", err
+	}
+	if absolute || origin == "" {
+		return decoded, nil
+	}
+	return decoded + "." + origin, nil
+}
+
+// Unescape decodes the escapes of the presentation format (RFC 1035 section 5.1):
+// `\DDD` stands for the byte with the decimal value DDD and `\X` for the character X,
+// such as `\"` for a quote inside a character string or `\032` for a space.
+//
+// Parameters:
+// - text: The text as written in a zone file.
+//
+// Returns:
+// - The decoded text.
+// - An error if a backslash ends the text or a `\DDD` escape exceeds 255.
+func Unescape(text string) (string, error) {
+	return unescape(text, false)
+}
+
+// unescape decodes the escapes of text like Unescape. Escapes of domain names must not decode
+// to a dot, which would turn into a label separator.
+func unescape(text string, name bool) (string, error) {
+	if !strings.Contains(text, "\\") {
+		return text, nil
+	}
+
+	var decoded strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '\\' {
+			decoded.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch {
+		case i == len(text):
+			return "", fmt.Errorf("'%s' ends with an incomplete escape", text)
+		case i+2 < len(text) && isDigit(text[i]) && isDigit(text[i+1]) && isDigit(text[i+2]):
+			value := int(text[i]-'0')*100 + int(text[i+1]-'0')*10 + int(text[i+2]-'0')
+			if value > 255 {
+				return "", fmt.Errorf("escape \\%s in '%s' exceeds 255", text[i:i+3], text)
+			}
+			c = byte(value)
+			i += 2
+		case isDigit(text[i]):
+			return "", fmt.Errorf("escape in '%s' needs three decimal digits", text)
+		default:
+			c = text[i]
+		}
+
+		if name && c == '.' {
+			return "", fmt.Errorf("escaped dot in a label of '%s' is not supported", text)
+		}
+		decoded.WriteByte(c)
+	}
+	return decoded.String(), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// ParseRData parses the record data of the given type from its presentation format,
+// the inverse of RData.String. Every type also accepts the generic format of RFC 3597,
+// such as `\# 4 0a000001`, which is the only format for types without a typed representation.
+//
+// Parameters:
+// - rrType: The type of the record.
+// - fields: The whitespace separated fields of the data, with the quotes of character strings removed
+// and their escapes still in place, see Unescape.
+// - origin: The origin relative domain names are qualified with, see QualifyName.
+//
+// Returns:
+// - The parsed RData.
+// - An error if the fields do not match the format of the type.
+func ParseRData(rrType Type, fields []string, origin string) (RData, error) {
+	if len(fields) > 0 && fields[0] == `\#` {
+		return parseGenericRData(rrType, fields[1:])
+	}
+
+	expect := func(count int) error {
+		if len(fields) != count {
+			return fmt.Errorf("%s record expects %d fields, got %d", rrType, count, len(fields))
+		}
+		return nil
+	}
+
+	switch rrType {
+	case TypeA:
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(fields[0]).To4()
+		if ip == nil || strings.Contains(fields[0], ":") {
+			return nil, fmt.Errorf("invalid IPv4 address '%s'", fields[0])
+		}
+		return &A{IP: ip}, nil
+
+	case TypeAAAA:
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || !strings.Contains(fields[0], ":") {
+			return nil, fmt.Errorf("invalid IPv6 address '%s'", fields[0])
+		}
+		return &AAAA{IP: ip}, nil
+
+	case TypeNS, TypeCNAME, TypePTR:
+		if err := expect(1); err != nil {
+			return nil, err
+		}
+		name, err := QualifyName(fields[0], origin)
+		if err != nil {
+			return nil, err
+		}
+		switch rrType {
+		case TypeNS:
+			return &NS{Host: name}, nil
+		case TypeCNAME:
+			return &CNAME{Target: name}, nil
+		default:
+			return &PTR{Ptr: name}, nil
+		}
+
+	case TypeMX:
+		if err := expect(2); err != nil {
+			return nil, err
+		}
+		preference, err := parseUint(fields[0], 16)
+		if err != nil {
+			return nil, err
+		}
+		exchange, err := QualifyName(fields[1], origin)
+		if err != nil {
+			return nil, err
+		}
+		return &MX{Preference: uint16(preference), Exchange: exchange}, nil
+
+	case TypeTXT:
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("TXT record expects at least one character string")
+		}
+		texts := make([]string, len(fields))
+		for i, field := range fields {
+			text, err := Unescape(field)
+			if err != nil {
+				return nil, err
+			}
+			if len(text) > 255 {
+				return nil, fmt.Errorf("character string exceeds 255 bytes")
+			}
+			texts[i] = text
+		}
+		return &TXT{Text: texts}, nil
+
+	case TypeSOA:
+		if err := expect(7); err != nil {
+			return nil, err
+		}
+		var timers [5]uint32
+		for i, field := range fields[2:] {
+			value, err := parseUint(field, 32)
+			if err != nil {
+				return nil, err
+			}
+			timers[i] = uint32(value)
+		}
+		var names [2]string
+		for i, field := range fields[:2] {
+			name, err := QualifyName(field, origin)
+			if err != nil {
+				return nil, err
+			}
+			names[i] = name
+		}
+		return &SOA{
+			MName:   names[0],
+			RName:   names[1],
+			Serial:  timers[0],
+			Refresh: timers[1],
+			Retry:   timers[2],
+			Expire:  timers[3],
+			Minimum: timers[4],
+		}, nil
+
+	case TypeSRV:
+		if err := expect(4); err != nil {
+			return nil, err
+		}
+		var numbers [3]uint16
+		for i, field := range fields[:3] {
+			value, err := parseUint(field, 16)
+			if err != nil {
+				return nil, err
+			}
+			numbers[i] = uint16(value)
+		}
+		target, err := QualifyName(fields[3], origin)
+		if err != nil {
+			return nil, err
+		}
+		return &SRV{Priority: numbers[0], Weight: numbers[1], Port: numbers[2], Target: target}, nil
+
+	case TypeCAA:
+		if err := expect(3); err != nil {
+			return nil, err
+		}
+		flag, err := parseUint(fields[0], 8)
+		if err != nil {
+			return nil, err
+		}
+		value, err := Unescape(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		return &CAA{Flag: uint8(flag), Tag: fields[1], Value: value}, nil
+
+	default:
+		return nil, fmt.Errorf("record type %s only supports the generic format", rrType)
+	}
+}
+
+// parseGenericRData parses the fields following `\#` in the generic format of RFC 3597:
+// the length of the data followed by the data in hexadecimal, possibly split into several fields.
+func parseGenericRData(rrType Type, fields []string) (RData, error) {
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("generic record data expects a length")
+	}
+	length, err := parseUint(fields[0], 16)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[1:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hexadecimal record data: %w", err)
+	}
+	if len(data) != int(length) {
+		return nil, fmt.Errorf("generic record data has %d bytes, expected %d", len(data), length)
+	}
+
+	// Decode the data like a received record, so known types get their typed representation
+	rdata := newRData(rrType)
+	if err := rdata.Unmarshal(data, 0, len(data)); err != nil {
+		return nil, err
+	}
+	return rdata, nil
+}
+
+// parseUint parses an unsigned decimal number of the given bit size.
+func parseUint(field string, bitSize int) (uint64, error) {
+	value, err := strconv.ParseUint(field, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %d bit number '%s'", bitSize, field)
+	}
+	return value, nil
+}
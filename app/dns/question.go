@@ -14,25 +14,13 @@ import (
 //
 // - Name: The domain name for which the query is being made. This is a fully qualified domain name (FQDN).
 //
-// - Type: A two-octet code which specifies the type of the query. The following values are defined:
-//   - 1: A (IPv4 address)
-//   - 2: NS (authoritative name server)
-//   - 5: CNAME (canonical name for an alias)
-//   - 6: SOA (start of a zone of authority)
-//   - 12: PTR (domain name pointer)
-//   - 15: MX (mail exchange)
-//   - 28: AAAA (IPv6 address)
-//   - 255: ANY (any type)
+// - Type: A two-octet code which specifies the type of the query, such as TypeA, TypeMX or TypeANY.
 //
-// - Class: A two-octet code that specifies the class of the query. The following values are defined:
-//   - 1: IN (Internet)
-//   - 3: CH (Chaos)
-//   - 4: HS (Hesiod)
-//   - 255: ANY (any class)
+// - Class: A two-octet code that specifies the class of the query, usually ClassIN.
 type Question struct {
 	Name  string
-	Type  uint16
-	Class uint16
+	Type  Type
+	Class Class
 }
 
 // Marshal encodes the DNS Question into a byte slice.
@@ -43,34 +31,20 @@ type Question struct {
 // - A byte slice containing the encoded DNS Question.
 // - An error if any issue occurs during encoding, such as a label exceeding 63 bytes.
 func (q *Question) Marshal() ([]byte, error) {
-	parts := strings.Split(q.Name, ".")
+	return q.marshalTo(make([]byte, 0, len(q.Name)+6), nil)
+}
 
-	byteCount := 0
-	for _, part := range parts {
-		if len(part) > 63 {
-			return nil, fmt.Errorf("label '%s' exceeds 63 bytes", part)
-		}
-		byteCount += len(part) + 1
+// marshalTo appends the wire form of the Question to msg, compressing its name with the given table.
+func (q *Question) marshalTo(msg []byte, compression map[string]int) ([]byte, error) {
+	msg, err := appendName(msg, q.Name, compression)
+	if err != nil {
+		return nil, err
 	}
-	byteCount++ // for the last 0x00
-
-	buffer := make([]byte, byteCount+4)
 
-	offset := 0
-	for _, part := range parts {
-		buffer[offset] = byte(len(part))
-		offset++
-		copy(buffer[offset:], part)
-		offset += len(part)
-	}
-	buffer[offset] = 0x00
-	offset++
+	msg = binary.BigEndian.AppendUint16(msg, uint16(q.Type))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(q.Class))
 
-	binary.BigEndian.PutUint16(buffer[offset:offset+2], q.Type)
-	offset += 2
-	binary.BigEndian.PutUint16(buffer[offset:offset+2], q.Class)
-
-	return buffer, nil
+	return msg, nil
 }
 
 // UnmarshalQuestions decodes a byte slice into a slice of DNS Question structs.
@@ -85,35 +59,49 @@ func (q *Question) Marshal() ([]byte, error) {
 //
 // - An error if any issue occurs during decoding.
 func UnmarshalQuestions(dnsMessage []byte, count uint16) ([]Question, error) {
-	offset := HeaderSize
+	questions, _, err := unmarshalQuestions(dnsMessage, HeaderSize, count)
+	return questions, err
+}
+
+// unmarshalQuestions decodes count questions starting at offset in the DNS message.
+// It returns the decoded questions together with the offset of the first byte after the question section.
+func unmarshalQuestions(dnsMessage []byte, offset int, count uint16) ([]Question, int, error) {
 	questions := make([]Question, 0, count)
 
 	for i := 0; i < int(count); i++ {
-		// Check if we have enough bytes left to read a question
-		typeClassByteCount := 4
-		if offset+typeClassByteCount > len(dnsMessage) {
-			return nil, fmt.Errorf("incomplete question at offset %d", offset)
+		if offset >= len(dnsMessage) {
+			return nil, offset, fmt.Errorf("%w: expected %d questions but found %d", ErrShortMessage, count, i)
 		}
 
-		label, bytesRead := parseLabel(dnsMessage[offset:], dnsMessage)
+		label, bytesRead, err := parseLabel(dnsMessage[offset:], dnsMessage)
+		if err != nil {
+			return nil, offset, fmt.Errorf("question at offset %d: %w", offset, err)
+		}
 		offset += bytesRead
 
-		fmt.Println("label parsed", label)
+		// Check if we have enough bytes left to read the type and class
+		typeClassByteCount := 4
+		if offset+typeClassByteCount > len(dnsMessage) {
+			return nil, offset, fmt.Errorf("%w: incomplete question at offset %d", ErrShortMessage, offset)
+		}
+
 		question := Question{
 			Name:  label,
-			Type:  1,
-			Class: 1,
+			Type:  Type(binary.BigEndian.Uint16(dnsMessage[offset:])),
+			Class: Class(binary.BigEndian.Uint16(dnsMessage[offset+2:])),
 		}
 
 		questions = append(questions, question)
 		offset += typeClassByteCount // type + class
 	}
 
-	return questions, nil
+	return questions, offset, nil
 }
 
 // parseLabel decodes a DNS label from a byte slice.
 // It handles both uncompressed and compressed labels as specified in RFC 1035.
+// Compression pointers are followed through the whole message, pointer loops are detected
+// and labels and names exceeding their maximum lengths are rejected, so it never reads out of bounds.
 //
 // Parameters:
 // - label: A byte slice containing the encoded DNS label.
@@ -124,42 +112,67 @@ func UnmarshalQuestions(dnsMessage []byte, count uint16) ([]Question, error) {
 // - A string representing the decoded domain name.
 //
 // - The number of bytes read from the label.
-func parseLabel(label []byte, dnsMessage []byte) (string, int) {
-	offset := 0
+//
+// - An error wrapping ErrShortMessage, ErrPointerLoop, ErrLabelTooLong or ErrNameTooLong if the name is malformed.
+func parseLabel(label []byte, dnsMessage []byte) (string, int, error) {
 	var parts []string
+	var visited []int
 
-	// Check for empty label
-	if len(label) == 0 {
-		return "", 0
-	}
+	data := label
+	offset := 0
+	bytesRead := -1 // known once the first compression pointer is met
+	nameLength := 1 // the terminating zero byte
 
-	// Main parsing loop
-	for offset < len(label) && label[offset] != 0 {
-		if label[offset]&0xC0 == 0xC0 {
-			if offset+2 > len(label) {
-				break
-			}
-			pointer := binary.BigEndian.Uint16(label[offset:offset+2]) & 0x3FFF
-			compressedLabel, _ := parseLabel(dnsMessage[pointer:], dnsMessage)
-			parts = append(parts, compressedLabel)
-			offset += 2
-			break // We should stop after a compression pointer
+	for {
+		if offset >= len(data) {
+			return "", 0, fmt.Errorf("%w: unterminated domain name", ErrShortMessage)
 		}
 
-		length := int(label[offset])
-		if offset+1+length > len(label) {
-			break
-		}
+		length := int(data[offset])
+		switch {
+		case length == 0:
+			if bytesRead < 0 {
+				bytesRead = offset + 1
+			}
+			return strings.Join(parts, "."), bytesRead, nil
 
-		labelPart := string(label[offset+1 : offset+1+length])
-		parts = append(parts, labelPart)
-		offset += length + 1
-	}
+		case length&0xC0 == 0xC0:
+			if offset+2 > len(data) {
+				return "", 0, fmt.Errorf("%w: truncated compression pointer", ErrShortMessage)
+			}
+			pointer := int(binary.BigEndian.Uint16(data[offset:offset+2]) & 0x3FFF)
+			if bytesRead < 0 {
+				// A compression pointer always ends the name, so the byte after it belongs to the next field
+				bytesRead = offset + 2
+			}
 
-	// Increment offset for the zero byte, if present
-	if offset < len(label) && label[offset] == 0 {
-		offset++
-	}
+			for _, seen := range visited {
+				if seen == pointer {
+					return "", 0, fmt.Errorf("%w at offset %d", ErrPointerLoop, pointer)
+				}
+			}
+			visited = append(visited, pointer)
 
-	return strings.Join(parts, "."), offset
+			if pointer >= len(dnsMessage) {
+				return "", 0, fmt.Errorf("%w: compression pointer %d outside the message", ErrShortMessage, pointer)
+			}
+			data = dnsMessage
+			offset = pointer
+
+		case length > maxLabelLength:
+			return "", 0, fmt.Errorf("%w: length byte %#02x", ErrLabelTooLong, length)
+
+		default:
+			if offset+1+length > len(data) {
+				return "", 0, fmt.Errorf("%w: truncated label", ErrShortMessage)
+			}
+			nameLength += length + 1
+			if nameLength > maxNameLength {
+				return "", 0, ErrNameTooLong
+			}
+
+			parts = append(parts, string(data[offset+1:offset+1+length]))
+			offset += length + 1
+		}
+	}
 }
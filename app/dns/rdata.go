@@ -0,0 +1,441 @@
+package dns
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RData is the type specific data of a resource record.
+// Every implementation knows its record type and how to convert itself to and from the wire format,
+// including any domain names embedded in the data.
+//
+// Methods:
+//
+// - Type: Returns the resource record type the data belongs to.
+//
+// - Marshal: Appends the wire form of the data to msg, the message built so far, and returns the extended message.
+// Types which embed domain names may compress them using the compression table, see appendName.
+// A nil table disables compression.
+//
+// - Unmarshal: Decodes length bytes of data starting at offset in dnsMessage. The whole message is needed
+// to resolve compressed domain names.
+//
+// - String: Returns the data in the presentation format used by zone files.
+type RData interface {
+	Type() Type
+	Marshal(msg []byte, compression map[string]int) ([]byte, error)
+	Unmarshal(dnsMessage []byte, offset, length int) error
+	String() string
+}
+
+// newRData returns an empty RData value for the given record type.
+// Types without a typed representation are returned as RawRData.
+func newRData(rrType Type) RData {
+	switch rrType {
+	case TypeA:
+		return &A{}
+	case TypeNS:
+		return &NS{}
+	case TypeCNAME:
+		return &CNAME{}
+	case TypeSOA:
+		return &SOA{}
+	case TypePTR:
+		return &PTR{}
+	case TypeMX:
+		return &MX{}
+	case TypeTXT:
+		return &TXT{}
+	case TypeAAAA:
+		return &AAAA{}
+	case TypeSRV:
+		return &SRV{}
+	case TypeCAA:
+		return &CAA{}
+	case TypeOPT:
+		return &OPT{}
+	default:
+		return &RawRData{RRType: rrType}
+	}
+}
+
+// A holds the IPv4 address of an A record (RFC 1035 section 3.4.1).
+type A struct {
+	IP net.IP
+}
+
+func (r *A) Type() Type { return TypeA }
+
+func (r *A) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	ip := r.IP.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("'%s' is not an IPv4 address", r.IP)
+	}
+	return append(msg, ip...), nil
+}
+
+func (r *A) Unmarshal(dnsMessage []byte, offset, length int) error {
+	if length != net.IPv4len {
+		return fmt.Errorf("A record data must be %d bytes, got %d", net.IPv4len, length)
+	}
+	r.IP = net.IP(append([]byte(nil), dnsMessage[offset:offset+length]...))
+	return nil
+}
+
+func (r *A) String() string { return r.IP.String() }
+
+// AAAA holds the IPv6 address of an AAAA record (RFC 3596).
+type AAAA struct {
+	IP net.IP
+}
+
+func (r *AAAA) Type() Type { return TypeAAAA }
+
+func (r *AAAA) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	ip := r.IP.To16()
+	if ip == nil {
+		return nil, fmt.Errorf("'%s' is not an IPv6 address", r.IP)
+	}
+	return append(msg, ip...), nil
+}
+
+func (r *AAAA) Unmarshal(dnsMessage []byte, offset, length int) error {
+	if length != net.IPv6len {
+		return fmt.Errorf("AAAA record data must be %d bytes, got %d", net.IPv6len, length)
+	}
+	r.IP = net.IP(append([]byte(nil), dnsMessage[offset:offset+length]...))
+	return nil
+}
+
+func (r *AAAA) String() string { return r.IP.String() }
+
+// NS holds the name server host of an NS record.
+type NS struct {
+	Host string
+}
+
+func (r *NS) Type() Type { return TypeNS }
+
+func (r *NS) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	return appendName(msg, r.Host, compression)
+}
+
+func (r *NS) Unmarshal(dnsMessage []byte, offset, length int) error {
+	var err error
+	r.Host, err = unmarshalOnlyName(dnsMessage, offset, length)
+	return err
+}
+
+func (r *NS) String() string { return FQDN(r.Host) }
+
+// CNAME holds the canonical name a CNAME record points to.
+type CNAME struct {
+	Target string
+}
+
+func (r *CNAME) Type() Type { return TypeCNAME }
+
+func (r *CNAME) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	return appendName(msg, r.Target, compression)
+}
+
+func (r *CNAME) Unmarshal(dnsMessage []byte, offset, length int) error {
+	var err error
+	r.Target, err = unmarshalOnlyName(dnsMessage, offset, length)
+	return err
+}
+
+func (r *CNAME) String() string { return FQDN(r.Target) }
+
+// PTR holds the domain name a PTR record points to.
+type PTR struct {
+	Ptr string
+}
+
+func (r *PTR) Type() Type { return TypePTR }
+
+func (r *PTR) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	return appendName(msg, r.Ptr, compression)
+}
+
+func (r *PTR) Unmarshal(dnsMessage []byte, offset, length int) error {
+	var err error
+	r.Ptr, err = unmarshalOnlyName(dnsMessage, offset, length)
+	return err
+}
+
+func (r *PTR) String() string { return FQDN(r.Ptr) }
+
+// MX holds the preference and mail exchange host of an MX record.
+type MX struct {
+	Preference uint16
+	Exchange   string
+}
+
+func (r *MX) Type() Type { return TypeMX }
+
+func (r *MX) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	msg = binary.BigEndian.AppendUint16(msg, r.Preference)
+	return appendName(msg, r.Exchange, compression)
+}
+
+func (r *MX) Unmarshal(dnsMessage []byte, offset, length int) error {
+	if length < 2 {
+		return fmt.Errorf("%w: MX record data", ErrShortMessage)
+	}
+	r.Preference = binary.BigEndian.Uint16(dnsMessage[offset:])
+
+	var err error
+	r.Exchange, err = unmarshalOnlyName(dnsMessage, offset+2, length-2)
+	return err
+}
+
+func (r *MX) String() string {
+	return fmt.Sprintf("%d %s", r.Preference, FQDN(r.Exchange))
+}
+
+// TXT holds the character strings of a TXT record. Each string is at most 255 bytes long.
+type TXT struct {
+	Text []string
+}
+
+func (r *TXT) Type() Type { return TypeTXT }
+
+func (r *TXT) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	for _, text := range r.Text {
+		var err error
+		msg, err = appendCharacterString(msg, text)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+func (r *TXT) Unmarshal(dnsMessage []byte, offset, length int) error {
+	r.Text = nil
+	end := offset + length
+	for offset < end {
+		text, bytesRead, err := unmarshalCharacterString(dnsMessage, offset, end)
+		if err != nil {
+			return err
+		}
+		r.Text = append(r.Text, text)
+		offset += bytesRead
+	}
+	return nil
+}
+
+func (r *TXT) String() string {
+	quoted := make([]string, len(r.Text))
+	for i, text := range r.Text {
+		quoted[i] = strconv.Quote(text)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// SOA holds the start of authority data of a zone (RFC 1035 section 3.3.13).
+//
+// Fields:
+//
+// - MName: The name server that was the original or primary source of data for the zone.
+//
+// - RName: The mailbox of the person responsible for the zone, encoded as a domain name.
+//
+// - Serial: The version number of the zone.
+//
+// - Refresh, Retry, Expire: Timers in seconds used by secondary servers.
+//
+// - Minimum: The TTL used for negative responses (RFC 2308).
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+func (r *SOA) Type() Type { return TypeSOA }
+
+func (r *SOA) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	msg, err := appendName(msg, r.MName, compression)
+	if err != nil {
+		return nil, err
+	}
+	msg, err = appendName(msg, r.RName, compression)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range []uint32{r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum} {
+		msg = binary.BigEndian.AppendUint32(msg, value)
+	}
+	return msg, nil
+}
+
+func (r *SOA) Unmarshal(dnsMessage []byte, offset, length int) error {
+	end := offset + length
+
+	mName, bytesRead, err := unmarshalName(dnsMessage, offset, end)
+	if err != nil {
+		return err
+	}
+	offset += bytesRead
+
+	rName, bytesRead, err := unmarshalName(dnsMessage, offset, end)
+	if err != nil {
+		return err
+	}
+	offset += bytesRead
+
+	if end-offset != 20 {
+		return fmt.Errorf("SOA record data has %d bytes of timers, expected 20", end-offset)
+	}
+
+	r.MName = mName
+	r.RName = rName
+	r.Serial = binary.BigEndian.Uint32(dnsMessage[offset:])
+	r.Refresh = binary.BigEndian.Uint32(dnsMessage[offset+4:])
+	r.Retry = binary.BigEndian.Uint32(dnsMessage[offset+8:])
+	r.Expire = binary.BigEndian.Uint32(dnsMessage[offset+12:])
+	r.Minimum = binary.BigEndian.Uint32(dnsMessage[offset+16:])
+	return nil
+}
+
+func (r *SOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d",
+		FQDN(r.MName), FQDN(r.RName), r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum)
+}
+
+// SRV holds the location of a service (RFC 2782).
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+func (r *SRV) Type() Type { return TypeSRV }
+
+func (r *SRV) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	msg = binary.BigEndian.AppendUint16(msg, r.Priority)
+	msg = binary.BigEndian.AppendUint16(msg, r.Weight)
+	msg = binary.BigEndian.AppendUint16(msg, r.Port)
+	// RFC 2782 forbids compressing the target name
+	return appendName(msg, r.Target, nil)
+}
+
+func (r *SRV) Unmarshal(dnsMessage []byte, offset, length int) error {
+	if length < 6 {
+		return fmt.Errorf("%w: SRV record data", ErrShortMessage)
+	}
+	r.Priority = binary.BigEndian.Uint16(dnsMessage[offset:])
+	r.Weight = binary.BigEndian.Uint16(dnsMessage[offset+2:])
+	r.Port = binary.BigEndian.Uint16(dnsMessage[offset+4:])
+
+	var err error
+	r.Target, err = unmarshalOnlyName(dnsMessage, offset+6, length-6)
+	return err
+}
+
+func (r *SRV) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, FQDN(r.Target))
+}
+
+// CAA holds a certification authority authorization property (RFC 8659).
+type CAA struct {
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+func (r *CAA) Type() Type { return TypeCAA }
+
+func (r *CAA) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	if len(r.Tag) == 0 || len(r.Tag) > 255 {
+		return nil, fmt.Errorf("CAA tag must be between 1 and 255 bytes")
+	}
+	msg = append(msg, r.Flag, byte(len(r.Tag)))
+	msg = append(msg, r.Tag...)
+	return append(msg, r.Value...), nil
+}
+
+func (r *CAA) Unmarshal(dnsMessage []byte, offset, length int) error {
+	if length < 2 {
+		return fmt.Errorf("%w: CAA record data", ErrShortMessage)
+	}
+	tagLength := int(dnsMessage[offset+1])
+	if 2+tagLength > length {
+		return fmt.Errorf("%w: CAA tag exceeds the record data", ErrShortMessage)
+	}
+
+	r.Flag = dnsMessage[offset]
+	r.Tag = string(dnsMessage[offset+2 : offset+2+tagLength])
+	r.Value = string(dnsMessage[offset+2+tagLength : offset+length])
+	return nil
+}
+
+func (r *CAA) String() string {
+	return fmt.Sprintf("%d %s %s", r.Flag, r.Tag, strconv.Quote(r.Value))
+}
+
+// RawRData holds the uninterpreted data of a record type without a typed representation.
+type RawRData struct {
+	RRType Type
+	Data   []byte
+}
+
+func (r *RawRData) Type() Type { return r.RRType }
+
+func (r *RawRData) Marshal(msg []byte, compression map[string]int) ([]byte, error) {
+	return append(msg, r.Data...), nil
+}
+
+func (r *RawRData) Unmarshal(dnsMessage []byte, offset, length int) error {
+	r.Data = append([]byte(nil), dnsMessage[offset:offset+length]...)
+	return nil
+}
+
+// String returns the data in the generic format of RFC 3597.
+func (r *RawRData) String() string {
+	if len(r.Data) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %s`, len(r.Data), hex.EncodeToString(r.Data))
+}
+
+// unmarshalOnlyName decodes record data that must consist of exactly one domain name.
+func unmarshalOnlyName(dnsMessage []byte, offset, length int) (string, error) {
+	name, bytesRead, err := unmarshalName(dnsMessage, offset, offset+length)
+	if err != nil {
+		return "", err
+	}
+	if bytesRead != length {
+		return "", fmt.Errorf("%d unexpected bytes after domain name '%s'", length-bytesRead, name)
+	}
+	return name, nil
+}
+
+// appendCharacterString appends a length prefixed <character-string> to msg.
+func appendCharacterString(msg []byte, text string) ([]byte, error) {
+	if len(text) > 255 {
+		return nil, fmt.Errorf("character string exceeds 255 bytes")
+	}
+	msg = append(msg, byte(len(text)))
+	return append(msg, text...), nil
+}
+
+// unmarshalCharacterString decodes the <character-string> at offset, which must end before end.
+func unmarshalCharacterString(dnsMessage []byte, offset, end int) (string, int, error) {
+	length := int(dnsMessage[offset])
+	if offset+1+length > end {
+		return "", 0, fmt.Errorf("%w: character string at offset %d exceeds the record data", ErrShortMessage, offset)
+	}
+	return string(dnsMessage[offset+1 : offset+1+length]), length + 1, nil
+}
@@ -0,0 +1,396 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by the Serve and ListenAndServe methods of a Server after Shutdown.
+var ErrServerClosed = errors.New("dns: server closed")
+
+const (
+	defaultUDPWorkers   = 64
+	defaultUDPQueueSize = 256
+	defaultIdleTimeout  = 10 * time.Second
+	defaultReadTimeout  = 2 * time.Second
+	defaultWriteTimeout = 2 * time.Second
+
+	// maxPacketSize is the largest DNS message that fits in a UDP datagram or a TCP frame.
+	maxPacketSize = 0xFFFF
+)
+
+// Server serves DNS queries received over UDP, TCP, TLS and QUIC with a Handler.
+// Every transport decodes the queries the same way and dispatch them to the same Handler,
+// which writes its answer through a ResponseWriter for the transport the query arrived over.
+//
+// Fields:
+//
+// - Addr: The address to listen on for ListenAndServe and ListenAndServeTLS, such as "127.0.0.1:2053".
+//
+// - Handler: The handler invoked for every query. A nil handler answers every query with REFUSED.
+//
+// - UDPWorkers: The number of UDP queries handled concurrently. Defaults to 64.
+//
+// - UDPQueueSize: The number of received UDP queries that may wait for a free worker. Queries arriving
+// while the queue is full are answered with REFUSED without invoking the handler. Defaults to 256.
+//
+// - IdleTimeout: How long a TCP, TLS or QUIC connection may wait for its next query before it is closed. Defaults to 10 seconds.
+//
+// - ReadTimeout: How long reading the rest of a TCP query may take once it started to arrive, or reading
+// the query of a QUIC stream. Defaults to 2 seconds.
+//
+// - WriteTimeout: How long writing a TCP or QUIC response may take. Defaults to 2 seconds.
+type Server struct {
+	Addr         string
+	Handler      Handler
+	UDPWorkers   int
+	UDPQueueSize int
+	IdleTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	mu        sync.Mutex
+	listeners []io.Closer
+	closed    bool
+}
+
+// ListenAndServe listens on Addr over both UDP and TCP and serves queries from both.
+// It blocks until one of the listeners fails or Shutdown is called, and then stops the other one.
+//
+// Returns:
+// - ErrServerClosed after Shutdown, or the error that stopped a listener.
+func (s *Server) ListenAndServe() error {
+	packetConn, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		_ = packetConn.Close()
+		return err
+	}
+
+	errs := make(chan error, 2)
+	go func() { errs <- s.ServeUDP(packetConn) }()
+	go func() { errs <- s.ServeTCP(listener) }()
+
+	err = <-errs
+	s.Shutdown()
+	return err
+}
+
+// Shutdown closes every listener of the server. Queries already being handled are not interrupted,
+// but their responses may fail to be sent.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for _, listener := range s.listeners {
+		if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			fmt.Println("Failed to close listener:", err)
+		}
+	}
+	s.listeners = nil
+}
+
+// ServeUDP reads queries from the packet connection and handles them on a bounded pool of workers.
+// Every query gets its own buffer, so a slow query never blocks the others.
+//
+// Parameters:
+// - conn: The packet connection to serve, usually created with net.ListenPacket("udp", ...).
+//
+// Returns:
+// - ErrServerClosed after Shutdown, or the error that stopped reading from the connection.
+func (s *Server) ServeUDP(conn net.PacketConn) error {
+	if err := s.track(conn); err != nil {
+		return err
+	}
+
+	requests := make(chan udpRequest, withDefault(s.UDPQueueSize, defaultUDPQueueSize))
+	defer close(requests)
+
+	for i := 0; i < withDefault(s.UDPWorkers, defaultUDPWorkers); i++ {
+		go s.serveUDPRequests(requests)
+	}
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		size, source, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		request := udpRequest{
+			packet: append([]byte(nil), buf[:size]...),
+			writer: &udpResponseWriter{conn: conn, remote: source},
+		}
+
+		select {
+		case requests <- request:
+		default:
+			fmt.Println("Too many queries in flight, refusing query from", source)
+			s.serveDNS(request.writer, request.packet, RCodeHandler(RCodeRefused))
+		}
+	}
+}
+
+// ServeTCP accepts connections from the listener and serves each of them on its own goroutine.
+// A connection may carry any number of length prefixed queries, see ReadTCPMessage.
+//
+// Parameters:
+// - listener: The listener to accept connections from, usually created with net.Listen("tcp", ...).
+//
+// Returns:
+// - ErrServerClosed after Shutdown, or the error that stopped accepting connections.
+func (s *Server) ServeTCP(listener net.Listener) error {
+	return s.serveListener(listener, "tcp")
+}
+
+// serveListener accepts stream connections from the listener and serves each of them on its own goroutine.
+func (s *Server) serveListener(listener net.Listener, network string) error {
+	if err := s.track(listener); err != nil {
+		return err
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		go s.serveStream(conn, network)
+	}
+}
+
+// udpRequest is a received UDP query waiting to be handled by a worker.
+type udpRequest struct {
+	packet []byte
+	writer ResponseWriter
+}
+
+// serveUDPRequests handles queued UDP queries until the queue is closed.
+func (s *Server) serveUDPRequests(requests <-chan udpRequest) {
+	for request := range requests {
+		s.serveDNS(request.writer, request.packet, s.handler())
+	}
+}
+
+// serveStream answers the length prefixed queries of a connection one after another
+// until the client closes it, it stays idle for too long or an error occurs.
+func (s *Server) serveStream(conn net.Conn, network string) {
+	defer func(conn net.Conn) {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			fmt.Println("Failed to close connection:", err)
+		}
+	}(conn)
+
+	writer := &streamResponseWriter{
+		conn:         conn,
+		network:      network,
+		writeTimeout: withDefault(s.WriteTimeout, defaultWriteTimeout),
+	}
+
+	for {
+		packet, err := s.readStreamQuery(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !s.isClosed() {
+				fmt.Println("Error receiving data from", conn.RemoteAddr(), ":", err)
+			}
+			return
+		}
+
+		s.serveDNS(writer, packet, s.handler())
+		if writer.err != nil {
+			fmt.Println("Closing connection to", conn.RemoteAddr(), "after failed write:", writer.err)
+			return
+		}
+	}
+}
+
+// readStreamQuery waits up to IdleTimeout for the next query to start
+// and then gives the rest of it ReadTimeout to arrive.
+func (s *Server) readStreamQuery(conn net.Conn) ([]byte, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(withDefault(s.IdleTimeout, defaultIdleTimeout))); err != nil {
+		return nil, err
+	}
+
+	return ReadTCPMessage(&deadlineReader{conn: conn, timeout: withDefault(s.ReadTimeout, defaultReadTimeout)})
+}
+
+// serveDNS decodes a query and passes it to the handler.
+// Packets which cannot be decoded are answered with FORMERR as long as their header is readable,
+// so the client can match the error to its query. Responses sent to the server are dropped.
+// Queries with several OPT records or an unsupported EDNS version never reach the handler.
+// A handler that panics is answered with SERVFAIL and keeps the server running, like net/http does.
+func (s *Server) serveDNS(w ResponseWriter, packet []byte, handler Handler) {
+	query, err := UnMarshallMessage(packet)
+	if err != nil {
+		fmt.Println("Failed to unmarshal message from", w.RemoteAddr(), ":", err)
+		s.replyFormatError(w, packet)
+		return
+	}
+	if query.Header.QR {
+		return
+	}
+
+	if udp, ok := w.(*udpResponseWriter); ok {
+		// Responses must fit the payload size both sides support, larger ones get truncated
+		udp.size = min(query.UDPSize(), DefaultEDNSUDPSize)
+	}
+
+	if rcode := CheckEDNS(query); rcode != RCodeSuccess {
+		RCodeHandler(rcode).ServeDNS(w, query)
+		return
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Printf("Handler panicked serving query from %s: %v\n%s", w.RemoteAddr(), err, debug.Stack())
+			RCodeHandler(RCodeServerFailure).ServeDNS(w, query)
+		}
+	}()
+	handler.ServeDNS(w, query)
+}
+
+// replyFormatError answers a packet that could not be decoded with FORMERR.
+// The response only carries the header because the questions of the packet cannot be trusted.
+func (s *Server) replyFormatError(w ResponseWriter, packet []byte) {
+	header, err := UnmarshalHeader(packet)
+	if err != nil || header.QR {
+		return
+	}
+
+	response := &Message{
+		Header: Header{
+			ID:     header.ID,
+			QR:     true,
+			OpCode: header.OpCode,
+			RD:     header.RD,
+			RCode:  RCodeFormatError,
+		},
+	}
+	if err := w.WriteMsg(response); err != nil {
+		fmt.Println("Failed to send response:", err)
+	}
+}
+
+func (s *Server) handler() Handler {
+	if s.Handler == nil {
+		return RCodeHandler(RCodeRefused)
+	}
+	return s.Handler
+}
+
+// track remembers a listener so Shutdown can close it.
+func (s *Server) track(listener io.Closer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// withDefault returns value, or fallback if value is not positive.
+func withDefault[T int | time.Duration](value, fallback T) T {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// udpResponseWriter writes responses to a client of a UDP packet connection.
+// Responses larger than size, or MinUDPSize if it is not set, are truncated, see Message.MarshalTruncated.
+type udpResponseWriter struct {
+	conn   net.PacketConn
+	remote net.Addr
+	size   int
+}
+
+func (w *udpResponseWriter) LocalAddr() net.Addr  { return w.conn.LocalAddr() }
+func (w *udpResponseWriter) RemoteAddr() net.Addr { return w.remote }
+func (w *udpResponseWriter) Network() string      { return "udp" }
+
+func (w *udpResponseWriter) WriteMsg(m *Message) error {
+	response, err := m.MarshalTruncated(withDefault(w.size, MinUDPSize))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.conn.WriteTo(response, w.remote)
+	return err
+}
+
+// streamResponseWriter writes length prefixed responses to a connection.
+// It remembers the first failed write so the connection can be closed afterwards.
+type streamResponseWriter struct {
+	conn         net.Conn
+	network      string
+	writeTimeout time.Duration
+	err          error
+}
+
+func (w *streamResponseWriter) LocalAddr() net.Addr  { return w.conn.LocalAddr() }
+func (w *streamResponseWriter) RemoteAddr() net.Addr { return w.conn.RemoteAddr() }
+func (w *streamResponseWriter) Network() string      { return w.network }
+
+func (w *streamResponseWriter) WriteMsg(m *Message) error {
+	response, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		w.err = err
+		return err
+	}
+	if err := WriteTCPMessage(w.conn, response); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// deadlineReader shortens the read deadline of a connection to timeout once the first byte was read.
+type deadlineReader struct {
+	conn    net.Conn
+	timeout time.Duration
+	started bool
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	n, err := r.conn.Read(p)
+	if n > 0 && !r.started {
+		r.started = true
+		if deadlineErr := r.conn.SetReadDeadline(time.Now().Add(r.timeout)); deadlineErr != nil {
+			return n, deadlineErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,195 @@
+package dns
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startUDPServer serves UDP queries for the test on a free loopback port and returns its address.
+func startUDPServer(t *testing.T, server *Server) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeUDP(conn)
+	t.Cleanup(server.Shutdown)
+	return conn.LocalAddr().String()
+}
+
+// exchangeUDP sends a query for name to the server and waits for its response.
+func exchangeUDP(t *testing.T, address string, id uint16, name string) *Message {
+	t.Helper()
+
+	return exchangeUDPMessage(t, address, &Message{
+		Header:    Header{ID: id, RD: true, QDCount: 1},
+		Questions: []Question{{Name: name, Type: TypeA, Class: ClassIN}},
+	})
+}
+
+// exchangeUDPMessage sends the query to the server and waits for its response.
+func exchangeUDPMessage(t *testing.T, address string, query *Message) *Message {
+	t.Helper()
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	defer conn.Close()
+
+	id := query.Header.ID
+	packet, err := query.Marshal()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	if _, err := conn.Write(packet); err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Error(err)
+		return nil
+	}
+	buf := make([]byte, maxPacketSize)
+	size, err := conn.Read(buf)
+	if err != nil {
+		t.Errorf("query %d: %v", id, err)
+		return nil
+	}
+	response, err := UnMarshallMessage(buf[:size])
+	if err != nil {
+		t.Errorf("query %d: %v", id, err)
+		return nil
+	}
+	if response.Header.ID != id {
+		t.Errorf("got response %d to query %d", response.Header.ID, id)
+	}
+	return response
+}
+
+func TestServeUDPConcurrentQueries(t *testing.T) {
+	const clients = 30
+	const delay = 300 * time.Millisecond
+
+	// The handler stands in for a slow upstream
+	address := startUDPServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Message) {
+		time.Sleep(delay)
+		_ = w.WriteMsg(NewResponse(r))
+	})})
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(id uint16) {
+			defer wg.Done()
+			if response := exchangeUDP(t, address, id, "example.com"); response != nil && response.RCode() != RCodeSuccess {
+				t.Errorf("query %d: got rcode %d", id, response.RCode())
+			}
+		}(uint16(i + 1))
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed >= 2*delay {
+		t.Errorf("%d concurrent queries took %v, expected about %v", clients, elapsed, delay)
+	}
+}
+
+func TestServeUDPRefusesWhenQueueIsFull(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(release)
+
+	// A queue size of 0 selects the default, so the smallest queue holds one query
+	address := startUDPServer(t, &Server{
+		UDPWorkers:   1,
+		UDPQueueSize: 1,
+		Handler: HandlerFunc(func(w ResponseWriter, r *Message) {
+			started <- struct{}{}
+			<-release
+			_ = w.WriteMsg(NewResponse(r))
+		}),
+	})
+
+	// The first query occupies the only worker, the second one waits in the queue
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		exchangeUDP(t, address, 1, "busy.example.com")
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first query never reached the handler")
+	}
+	go func() {
+		defer wg.Done()
+		exchangeUDP(t, address, 2, "queued.example.com")
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	response := exchangeUDP(t, address, 3, "overflow.example.com")
+	if response == nil {
+		return
+	}
+	if response.RCode() != RCodeRefused {
+		t.Errorf("got rcode %d for the overflowing query, expected REFUSED", response.RCode())
+	}
+	if len(response.Questions) != 1 || response.Questions[0].Name != "overflow.example.com" {
+		t.Errorf("got questions %v, expected the overflowing question", response.Questions)
+	}
+}
+
+func TestServeDNSRecoversFromPanics(t *testing.T) {
+	address := startUDPServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Message) {
+		panic("broken handler")
+	})})
+
+	for id := uint16(1); id <= 2; id++ {
+		response := exchangeUDP(t, address, id, "example.com")
+		if response == nil {
+			return
+		}
+		if response.RCode() != RCodeServerFailure {
+			t.Errorf("query %d: got rcode %d, expected SERVFAIL", id, response.RCode())
+		}
+	}
+}
+
+func TestServeDNSChecksEDNS(t *testing.T) {
+	var served atomic.Int32
+	address := startUDPServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Message) {
+		served.Add(1)
+		_ = w.WriteMsg(NewResponse(r))
+	})})
+
+	badVersion := ednsQuery(&EDNS{UDPSize: 4096, Version: 1})
+	if response := exchangeUDPMessage(t, address, badVersion); response != nil {
+		if response.RCode() != RCodeBadVers || response.EDNS().Version != 0 {
+			t.Errorf("EDNS version 1 answered with rcode %d and EDNS %+v, expected BADVERS and version 0", response.RCode(), response.EDNS())
+		}
+	}
+
+	twoOPT := ednsQuery(&EDNS{UDPSize: 4096})
+	twoOPT.Additional = append(twoOPT.Additional, twoOPT.Additional[0])
+	twoOPT.Header.ARCount = 2
+	if response := exchangeUDPMessage(t, address, twoOPT); response != nil && response.RCode() != RCodeFormatError {
+		t.Errorf("query with two OPT records answered with rcode %d, expected FORMERR", response.RCode())
+	}
+
+	if response := exchangeUDPMessage(t, address, ednsQuery(&EDNS{UDPSize: 4096})); response != nil && response.RCode() != RCodeSuccess {
+		t.Errorf("valid EDNS query answered with rcode %d", response.RCode())
+	}
+	if got := served.Load(); got != 1 {
+		t.Errorf("handler served %d queries, expected only the valid one", got)
+	}
+}
@@ -0,0 +1,59 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ReadTCPMessage reads one DNS message framed for stream transports.
+// Over TCP every message is prefixed with its length as a two byte big endian integer (RFC 1035 section 4.2.2).
+//
+// Parameters:
+// - r: The stream to read from.
+//
+// Returns:
+// - A byte slice containing the message without the length prefix.
+// - io.EOF if the stream ended cleanly before a new message, or any other read error.
+func ReadTCPMessage(r io.Reader) ([]byte, error) {
+	var prefix [2]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint16(prefix[:])
+	if length < HeaderSize {
+		return nil, fmt.Errorf("%w: length prefix of %d bytes", ErrShortHeader, length)
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return message, nil
+}
+
+// WriteTCPMessage writes one DNS message framed for stream transports, see ReadTCPMessage.
+// The length prefix and the message are written with a single call so they travel in one segment.
+//
+// Parameters:
+// - w: The stream to write to.
+// - message: The encoded DNS message.
+//
+// Returns:
+// - An error if the message exceeds 65535 bytes or the write fails.
+func WriteTCPMessage(w io.Writer, message []byte) error {
+	if len(message) > 0xFFFF {
+		return fmt.Errorf("message of %d bytes exceeds the 65535 byte TCP limit", len(message))
+	}
+
+	framed := make([]byte, 0, len(message)+2)
+	framed = binary.BigEndian.AppendUint16(framed, uint16(len(message)))
+	framed = append(framed, message...)
+
+	_, err := w.Write(framed)
+	return err
+}
@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// LoadTLSConfig builds the TLS configuration of a DNS-over-TLS server from PEM encoded files.
+// TLS 1.2 is the oldest accepted version, as RFC 8310 section 9 requires, and the "dot"
+// application protocol is advertised through ALPN.
+//
+// Parameters:
+// - certFile: The path of the certificate, followed by any intermediate certificates.
+// - keyFile: The path of the private key of the certificate.
+//
+// Returns:
+// - A pointer to the TLS configuration.
+// - An error if the certificate or the key cannot be loaded.
+func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"dot"},
+	}, nil
+}
+
+// ListenAndServeTLS listens on Addr over TCP and serves DNS over TLS (RFC 7858), usually on port 853.
+// It blocks until the listener fails or Shutdown is called.
+//
+// Parameters:
+// - certFile: The path of the PEM encoded certificate.
+// - keyFile: The path of the PEM encoded private key.
+//
+// Returns:
+// - ErrServerClosed after Shutdown, or the error that stopped the listener.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	config, err := LoadTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	listener, err := tls.Listen("tcp", s.Addr, config)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(listener)
+}
+
+// ServeTLS accepts TLS connections from the listener and serves each of them on its own goroutine.
+// The queries are framed like over TCP and a connection may carry any number of them, so clients
+// can reuse it; connections are closed after IdleTimeout without a query. The TLS handshake
+// happens while waiting for the first query.
+//
+// Parameters:
+// - listener: The listener to accept connections from, usually created with tls.Listen.
+//
+// Returns:
+// - ErrServerClosed after Shutdown, or the error that stopped accepting connections.
+func (s *Server) ServeTLS(listener net.Listener) error {
+	return s.serveListener(listener, "tcp-tls")
+}
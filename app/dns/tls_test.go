@@ -0,0 +1,161 @@
+package dns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCertificate generates a certificate for 127.0.0.1, writes it and its key
+// as PEM files into a temporary directory and returns their paths with the parsed certificate.
+func writeSelfSignedCertificate(t *testing.T) (string, string, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, certificate
+}
+
+// startTLSServer serves DNS over TLS for the test on a free loopback port and returns a client connection to it.
+func startTLSServer(t *testing.T, server *Server) *tls.Conn {
+	t.Helper()
+
+	certFile, keyFile, certificate := writeSelfSignedCertificate(t)
+	config, err := LoadTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(listener)
+	t.Cleanup(server.Shutdown)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots, NextProtos: []string{"dot"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// exchangeStream sends a query for name over the connection and reads its response.
+func exchangeStream(t *testing.T, conn net.Conn, id uint16, name string) *Message {
+	t.Helper()
+
+	query := &Message{
+		Header:    Header{ID: id, RD: true},
+		Questions: []Question{{Name: name, Type: TypeA, Class: ClassIN}},
+	}
+	packet, err := query.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTCPMessage(conn, packet); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := ReadTCPMessage(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := UnMarshallMessage(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Header.ID != id {
+		t.Fatalf("got response %d to query %d", response.Header.ID, id)
+	}
+	return response
+}
+
+func TestServeTLSReusesConnections(t *testing.T) {
+	networks := make(chan string, 2)
+	conn := startTLSServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Message) {
+		networks <- w.Network()
+		_ = w.WriteMsg(NewResponse(r))
+	})})
+
+	exchangeStream(t, conn, 1, "one.example.com")
+	exchangeStream(t, conn, 2, "two.example.com")
+
+	if protocol := conn.ConnectionState().NegotiatedProtocol; protocol != "dot" {
+		t.Errorf("negotiated protocol '%s', expected dot", protocol)
+	}
+	if version := conn.ConnectionState().Version; version < tls.VersionTLS12 {
+		t.Errorf("negotiated TLS version %x, expected at least 1.2", version)
+	}
+	for i := 0; i < 2; i++ {
+		if network := <-networks; network != "tcp-tls" {
+			t.Errorf("handler saw network '%s', expected tcp-tls", network)
+		}
+	}
+}
+
+func TestServeTLSClosesIdleConnections(t *testing.T) {
+	const idleTimeout = 200 * time.Millisecond
+	conn := startTLSServer(t, &Server{IdleTimeout: idleTimeout, Handler: RCodeHandler(RCodeSuccess)})
+
+	exchangeStream(t, conn, 1, "example.com")
+
+	start := time.Now()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read data from an idle connection, expected it to be closed")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("the server did not close the idle connection")
+	}
+	if elapsed := time.Since(start); elapsed < idleTimeout/2 {
+		t.Errorf("connection closed after %v, expected about %v", elapsed, idleTimeout)
+	}
+}
@@ -0,0 +1,67 @@
+package dns
+
+// MarshalTruncated encodes the message like Marshal, fitting it into at most size bytes.
+// Messages which are too large lose whole RRsets, starting at the end of the additional section,
+// then the authority section and finally the answer section; a record is never cut in half.
+// The OPT record is always kept. If records of the answer or authority section had to be dropped
+// the TC bit is set, telling the client to retry over TCP (RFC 2181 section 9). The message
+// itself is not modified.
+//
+// Parameters:
+// - size: The largest acceptable encoded size, usually the UDP payload size of the client.
+//
+// Returns:
+// - A byte slice containing the encoded message, larger than size only if even the header,
+// the questions and the OPT record do not fit.
+// - An error if any question or record cannot be encoded.
+func (m *Message) MarshalTruncated(size int) ([]byte, error) {
+	encoded, err := m.Marshal()
+	if err != nil || len(encoded) <= size {
+		return encoded, err
+	}
+
+	var opt, additional []Answer
+	for _, record := range m.Additional {
+		if record.Type == TypeOPT {
+			opt = append(opt, record)
+		} else {
+			additional = append(additional, record)
+		}
+	}
+
+	truncated := *m
+	sections := [][]Answer{m.Answers, m.Authority, additional}
+	for section := len(sections) - 1; section >= 0; section-- {
+		for len(sections[section]) > 0 {
+			sections[section] = withoutLastRRset(sections[section])
+			if section != 2 {
+				truncated.Header.TC = true
+			}
+
+			truncated.Answers = sections[0]
+			truncated.Authority = sections[1]
+			truncated.Additional = append(append([]Answer(nil), sections[2]...), opt...)
+
+			encoded, err = truncated.Marshal()
+			if err != nil || len(encoded) <= size {
+				return encoded, err
+			}
+		}
+	}
+	return encoded, nil
+}
+
+// withoutLastRRset returns a copy of the records without the RRset of the last record:
+// every record sharing its name, type and class.
+func withoutLastRRset(records []Answer) []Answer {
+	last := records[len(records)-1]
+	name := CanonicalName(last.Name)
+
+	kept := make([]Answer, 0, len(records)-1)
+	for _, record := range records {
+		if record.Type != last.Type || record.Class != last.Class || CanonicalName(record.Name) != name {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
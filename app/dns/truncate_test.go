@@ -0,0 +1,212 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// truncationTestMessage returns a response with two RRsets in the answer section, the second with
+// three large TXT records, an NS RRset in the authority section, glue in the additional section
+// and an OPT record.
+func truncationTestMessage() *Message {
+	record := func(name string, rdata RData) Answer {
+		return Answer{Name: name, Type: rdata.Type(), Class: ClassIN, TTL: 300, RData: rdata}
+	}
+	text := strings.Repeat("x", 100)
+
+	message := &Message{
+		Header:    Header{ID: 1, QR: true},
+		Questions: []Question{{Name: "example.com", Type: TypeANY, Class: ClassIN}},
+		Answers: []Answer{
+			record("example.com", &A{IP: net.IPv4(192, 0, 2, 1).To4()}),
+			record("example.com", &A{IP: net.IPv4(192, 0, 2, 2).To4()}),
+			record("example.com", &TXT{Text: []string{text + "1"}}),
+			record("example.com", &TXT{Text: []string{text + "2"}}),
+			record("example.com", &TXT{Text: []string{text + "3"}}),
+		},
+	}
+	for i := 1; i <= 4; i++ {
+		host := fmt.Sprintf("ns%d.example.com", i)
+		message.Authority = append(message.Authority, record("example.com", &NS{Host: host}))
+		message.Additional = append(message.Additional, record(host, &AAAA{IP: net.ParseIP(fmt.Sprintf("2001:db8::%d", i))}))
+	}
+	message.SetEDNS(&EDNS{UDPSize: DefaultEDNSUDPSize})
+	return message
+}
+
+// countTypes returns how many records of each type a section holds.
+func countTypes(records []Answer) map[Type]int {
+	counts := make(map[Type]int)
+	for _, record := range records {
+		counts[record.Type]++
+	}
+	return counts
+}
+
+// encodedSize returns the size of the message without truncation.
+func encodedSize(t *testing.T, m *Message) int {
+	t.Helper()
+
+	encoded, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(encoded)
+}
+
+// truncate fits the message into size bytes and decodes the result.
+func truncate(t *testing.T, m *Message, size int) *Message {
+	t.Helper()
+
+	encoded, err := m.MarshalTruncated(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded) > size {
+		t.Fatalf("truncated message has %d bytes, expected at most %d", len(encoded), size)
+	}
+	truncated, err := UnMarshallMessage(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return truncated
+}
+
+func TestMarshalTruncatedKeepsMessagesThatFit(t *testing.T) {
+	message := truncationTestMessage()
+	truncated := truncate(t, message, encodedSize(t, message))
+
+	if truncated.Header.TC || len(truncated.Answers) != 5 || len(truncated.Authority) != 4 || len(truncated.Additional) != 5 {
+		t.Errorf("message that fits was changed: TC %t, %d answers, %d authority, %d additional records",
+			truncated.Header.TC, len(truncated.Answers), len(truncated.Authority), len(truncated.Additional))
+	}
+}
+
+func TestMarshalTruncatedDropsAdditionalFirst(t *testing.T) {
+	message := truncationTestMessage()
+	// SetEDNS put the OPT record last
+	withoutGlue := *message
+	withoutGlue.Additional = message.Additional[len(message.Additional)-1:]
+
+	truncated := truncate(t, message, encodedSize(t, &withoutGlue))
+	if truncated.Header.TC {
+		t.Error("TC set although only additional records were dropped")
+	}
+	if len(truncated.Answers) != 5 || len(truncated.Authority) != 4 {
+		t.Errorf("kept %d answers and %d authority records, expected all of them", len(truncated.Answers), len(truncated.Authority))
+	}
+	if len(truncated.Additional) != 1 || truncated.EDNS() == nil {
+		t.Errorf("kept additional records %v, expected only the OPT record", truncated.Additional)
+	}
+	if len(message.Additional) != 5 {
+		t.Error("MarshalTruncated modified the message")
+	}
+}
+
+func TestMarshalTruncatedDropsWholeRRsets(t *testing.T) {
+	message := truncationTestMessage()
+
+	for size := encodedSize(t, message) - 1; size >= 300; size -= 20 {
+		truncated := truncate(t, message, size)
+
+		answers := countTypes(truncated.Answers)
+		if answers[TypeTXT] != 0 && answers[TypeTXT] != 3 || answers[TypeA] != 0 && answers[TypeA] != 2 {
+			t.Errorf("size %d: answer RRsets were split, kept %v", size, answers)
+		}
+		if n := len(truncated.Authority); n != 0 && n != 4 {
+			t.Errorf("size %d: the NS RRset was split, kept %d records", size, n)
+		}
+
+		// Later sections go first, and TC is set as soon as answer or authority records go
+		lostAuthority := len(truncated.Authority) < 4
+		lostAnswers := len(truncated.Answers) < 5
+		if lostAuthority && len(truncated.Additional) > 1 || lostAnswers && len(truncated.Authority) > 0 {
+			t.Errorf("size %d: dropped records of an earlier section first", size)
+		}
+		if truncated.Header.TC != (lostAuthority || lostAnswers) {
+			t.Errorf("size %d: TC is %t with %d answers and %d authority records", size, truncated.Header.TC, len(truncated.Answers), len(truncated.Authority))
+		}
+		if edns := truncated.EDNS(); edns == nil || edns.UDPSize != DefaultEDNSUDPSize {
+			t.Errorf("size %d: the OPT record was not kept", size)
+		}
+	}
+}
+
+// exchangeUDPSize sends the query to the server and returns the size of the response and the response.
+func exchangeUDPSize(t *testing.T, address string, query *Message) (int, *Message) {
+	t.Helper()
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	packet, err := query.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(packet); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxPacketSize)
+	size, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := UnMarshallMessage(buf[:size])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return size, response
+}
+
+func TestServeUDPTruncatesToClientSize(t *testing.T) {
+	// Around 2000 bytes of answers, larger than any UDP size the server accepts
+	address := startUDPServer(t, &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Message) {
+		response := NewResponse(r)
+		for i := 0; i < 20; i++ {
+			response.Answers = append(response.Answers, Answer{
+				Name: fmt.Sprintf("host%d.example.com", i), Type: TypeTXT, Class: ClassIN, TTL: 60,
+				RData: &TXT{Text: []string{strings.Repeat("y", 80)}},
+			})
+		}
+		_ = w.WriteMsg(response)
+	})})
+
+	tests := []struct {
+		description string
+		edns        *EDNS
+		limit       int
+	}{
+		{"without EDNS", nil, MinUDPSize},
+		{"with a small EDNS size", &EDNS{UDPSize: 700}, 700},
+		{"with a large EDNS size", &EDNS{UDPSize: 4096}, DefaultEDNSUDPSize},
+	}
+
+	for _, test := range tests {
+		query := &Message{
+			Header:    Header{ID: 3},
+			Questions: []Question{{Name: "example.com", Type: TypeTXT, Class: ClassIN}},
+		}
+		query.SetEDNS(test.edns)
+
+		size, response := exchangeUDPSize(t, address, query)
+		if size > test.limit {
+			t.Errorf("%s: got %d bytes, expected at most %d", test.description, size, test.limit)
+		}
+		if !response.Header.TC || len(response.Answers) == 0 {
+			t.Errorf("%s: got TC %t with %d answers, expected a truncated response", test.description, response.Header.TC, len(response.Answers))
+		}
+		if (test.edns != nil) != (response.EDNS() != nil) {
+			t.Errorf("%s: response EDNS %+v", test.description, response.EDNS())
+		}
+	}
+}
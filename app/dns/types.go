@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type is the two-octet code which specifies the type of a resource record or of a query.
+type Type uint16
+
+// Resource record types and query types (QTYPEs) as registered with IANA.
+const (
+	TypeA     Type = 1
+	TypeNS    Type = 2
+	TypeCNAME Type = 5
+	TypeSOA   Type = 6
+	TypePTR   Type = 12
+	TypeHINFO Type = 13
+	TypeMX    Type = 15
+	TypeTXT   Type = 16
+	TypeAAAA  Type = 28
+	TypeSRV   Type = 33
+	TypeOPT   Type = 41
+	TypeDS    Type = 43
+	TypeRRSIG Type = 46
+	TypeNSEC  Type = 47
+	TypeHTTPS Type = 65
+	TypeAXFR  Type = 252
+	TypeANY   Type = 255
+	TypeCAA   Type = 257
+)
+
+var typeNames = map[Type]string{
+	TypeA:     "A",
+	TypeNS:    "NS",
+	TypeCNAME: "CNAME",
+	TypeSOA:   "SOA",
+	TypePTR:   "PTR",
+	TypeHINFO: "HINFO",
+	TypeMX:    "MX",
+	TypeTXT:   "TXT",
+	TypeAAAA:  "AAAA",
+	TypeSRV:   "SRV",
+	TypeOPT:   "OPT",
+	TypeDS:    "DS",
+	TypeRRSIG: "RRSIG",
+	TypeNSEC:  "NSEC",
+	TypeHTTPS: "HTTPS",
+	TypeAXFR:  "AXFR",
+	TypeANY:   "ANY",
+	TypeCAA:   "CAA",
+}
+
+// String returns the mnemonic of the type, or the generic TYPEnnn form of RFC 3597 for unknown types.
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// ParseType returns the type with the given mnemonic, such as "AAAA", or in the generic TYPEnnn form of RFC 3597.
+// Mnemonics are matched case-insensitively.
+//
+// Parameters:
+// - name: The mnemonic of the type.
+//
+// Returns:
+// - The Type.
+// - An error if the name is not a known mnemonic or a valid TYPEnnn form.
+func ParseType(name string) (Type, error) {
+	upper := strings.ToUpper(name)
+	for t, typeName := range typeNames {
+		if typeName == upper {
+			return t, nil
+		}
+	}
+
+	if number, ok := strings.CutPrefix(upper, "TYPE"); ok {
+		if value, err := strconv.ParseUint(number, 10, 16); err == nil {
+			return Type(value), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown record type '%s'", name)
+}
+
+// Class is the two-octet code which specifies the class of a resource record or of a query.
+type Class uint16
+
+// Classes and query classes (QCLASSes) defined in RFC 1035.
+const (
+	ClassIN  Class = 1
+	ClassCH  Class = 3
+	ClassHS  Class = 4
+	ClassANY Class = 255
+)
+
+var classNames = map[Class]string{
+	ClassIN:  "IN",
+	ClassCH:  "CH",
+	ClassHS:  "HS",
+	ClassANY: "ANY",
+}
+
+// String returns the mnemonic of the class, or the generic CLASSnnn form of RFC 3597 for unknown classes.
+func (c Class) String() string {
+	if name, ok := classNames[c]; ok {
+		return name
+	}
+	return "CLASS" + strconv.Itoa(int(c))
+}
+
+// ParseClass returns the class with the given mnemonic, such as "IN", or in the generic CLASSnnn form of RFC 3597.
+// Mnemonics are matched case-insensitively.
+//
+// Parameters:
+// - name: The mnemonic of the class.
+//
+// Returns:
+// - The Class.
+// - An error if the name is not a known mnemonic or a valid CLASSnnn form.
+func ParseClass(name string) (Class, error) {
+	upper := strings.ToUpper(name)
+	for c, className := range classNames {
+		if className == upper {
+			return c, nil
+		}
+	}
+
+	if number, ok := strings.CutPrefix(upper, "CLASS"); ok {
+		if value, err := strconv.ParseUint(number, 10, 16); err == nil {
+			return Class(value), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown class '%s'", name)
+}
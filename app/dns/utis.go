@@ -1,6 +1,10 @@
 package dns
 
-import "strings"
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
 
 // EncodeLabel encodes a domain name label into the DNS label format.
 // The DNS label format is a sequence of labels where each label is prefixed
@@ -12,7 +16,11 @@ import "strings"
 // Returns:
 // - A byte slice containing the encoded label in DNS format.
 func EncodeLabel(label string) []byte {
-	parts := strings.Split(label, ".")
+	parts := strings.Split(strings.TrimSuffix(label, "."), ".")
+	if len(label) == 0 || label == "." {
+		parts = nil
+	}
+
 	byteCount := 0
 
 	for _, part := range parts {
@@ -36,3 +44,93 @@ func EncodeLabel(label string) []byte {
 
 	return buffer
 }
+
+// appendName appends the wire form of a domain name to msg.
+// Both "example.com" and "example.com." are accepted, and "" or "." encode the root name.
+//
+// When compression is not nil the name is compressed as described in RFC 1035 section 4.1.4.
+// The table maps every name suffix written so far to its offset from the start of the message,
+// so msg must hold the whole message from its first header byte. The longest suffix of name found
+// in the table is replaced by a pointer and every suffix written in full is added to the table.
+//
+// Parameters:
+// - msg: The message built so far.
+// - name: The domain name to encode.
+// - compression: The compression table of the message, or nil to write the name in full.
+//
+// Returns:
+// - The extended message.
+// - An error if a label of the name is empty or exceeds 63 bytes.
+func appendName(msg []byte, name string, compression map[string]int) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return append(msg, 0x00), nil
+	}
+
+	parts := strings.Split(name, ".")
+	for _, part := range parts {
+		if len(part) == 0 {
+			return nil, fmt.Errorf("empty label in name '%s'", name)
+		}
+		if len(part) > 63 {
+			return nil, fmt.Errorf("%w: '%s'", ErrLabelTooLong, part)
+		}
+	}
+	if len(name)+2 > maxNameLength {
+		return nil, fmt.Errorf("%w: '%s'", ErrNameTooLong, name)
+	}
+
+	for i, part := range parts {
+		if compression != nil {
+			suffix := strings.Join(parts[i:], ".")
+			if pointer, ok := compression[suffix]; ok {
+				return binary.BigEndian.AppendUint16(msg, 0xC000|uint16(pointer)), nil
+			}
+			// Pointers only have 14 bits, later offsets cannot be referenced
+			if len(msg) <= 0x3FFF {
+				compression[suffix] = len(msg)
+			}
+		}
+
+		msg = append(msg, byte(len(part)))
+		msg = append(msg, part...)
+	}
+
+	return append(msg, 0x00), nil
+}
+
+// unmarshalName decodes the domain name starting at offset, which must end before end.
+// It returns the name and the number of bytes it occupies at offset.
+func unmarshalName(dnsMessage []byte, offset, end int) (string, int, error) {
+	if offset >= end {
+		return "", 0, fmt.Errorf("%w: missing domain name at offset %d", ErrShortMessage, offset)
+	}
+
+	return parseLabel(dnsMessage[offset:end], dnsMessage)
+}
+
+// FQDN returns the name in presentation format, with the trailing dot of the root.
+func FQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// CanonicalName returns name in the form used to compare domain names: lower case and
+// without the trailing dot of the root. The root itself is returned as the empty string.
+func CanonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// IsSubDomain reports whether child is equal to parent or is located below it.
+// Names are compared case-insensitively on label boundaries, so "notexample.com" is not below "example.com".
+func IsSubDomain(parent, child string) bool {
+	parent = CanonicalName(parent)
+	child = CanonicalName(child)
+
+	if parent == "" || parent == child {
+		return true
+	}
+	return strings.HasSuffix(child, "."+parent)
+}
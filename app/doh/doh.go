@@ -0,0 +1,188 @@
+package doh
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ContentType is the media type of DNS messages exchanged over HTTPS.
+	ContentType = "application/dns-message"
+
+	// Path is the conventional path of the DNS-over-HTTPS endpoint.
+	Path = "/dns-query"
+
+	// maxMessageSize is the largest DNS message accepted in a request.
+	maxMessageSize = 0xFFFF
+)
+
+// Handler serves DNS over HTTPS as described in RFC 8484, passing the decoded queries to a dns.Handler.
+// Queries arrive either as the base64url encoded "dns" parameter of a GET request or as the body
+// of a POST request with the application/dns-message content type. Responses carry a Cache-Control
+// header whose max-age is the smallest TTL of the response.
+//
+// Handler is an http.Handler, so it can be mounted on any path of an existing HTTP server:
+//
+//	mux.Handle(doh.Path, doh.NewHandler(dnsHandler))
+type Handler struct {
+	DNS dns.Handler
+}
+
+// NewHandler creates a Handler answering queries with the given dns.Handler.
+//
+// Parameters:
+// - handler: The handler answering the decoded queries.
+//
+// Returns:
+// - A pointer to the Handler.
+func NewHandler(handler dns.Handler) *Handler {
+	return &Handler{DNS: handler}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	packet, status, err := readQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	query, err := dns.UnMarshallMessage(packet)
+	if err != nil || query.Header.QR {
+		http.Error(w, "malformed DNS query", http.StatusBadRequest)
+		return
+	}
+
+	response := Exchange(h.DNS, r, query)
+	if response == nil {
+		http.Error(w, "no DNS response", http.StatusBadGateway)
+		return
+	}
+
+	encoded, err := response.Marshal()
+	if err != nil {
+		fmt.Println("Failed to marshal response:", err)
+		http.Error(w, "failed to encode DNS response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(encoded)))
+	w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(MinTTL(response)), 10))
+	if _, err := w.Write(encoded); err != nil {
+		fmt.Println("Failed to send response:", err)
+	}
+}
+
+// readQuery extracts the encoded query from a GET or POST request.
+// On failure it returns the HTTP status describing the problem.
+func readQuery(r *http.Request) ([]byte, int, error) {
+	switch r.Method {
+	case http.MethodGet:
+		encoded := r.URL.Query().Get("dns")
+		if encoded == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("missing dns parameter")
+		}
+		// RFC 8484 forbids padding, but tolerating it costs nothing
+		packet, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid base64url in dns parameter")
+		}
+		return packet, http.StatusOK, nil
+
+	case http.MethodPost:
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != ContentType {
+			return nil, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be %s", ContentType)
+		}
+		packet, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if len(packet) > maxMessageSize {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("query exceeds %d bytes", maxMessageSize)
+		}
+		return packet, http.StatusOK, nil
+
+	default:
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)
+	}
+}
+
+// Exchange passes a query received over HTTP to the handler and returns the response it wrote.
+//
+// Parameters:
+// - handler: The handler answering the query.
+// - r: The HTTP request the query arrived with, providing the addresses of the client and the server.
+// The network of the dns.ResponseWriter is "https" for requests received over TLS and "http" otherwise.
+// - query: The decoded query.
+//
+// Returns:
+// - A pointer to the response, or nil if the handler did not write one.
+func Exchange(handler dns.Handler, r *http.Request, query *dns.Message) *dns.Message {
+	writer := &responseWriter{remote: addr(r.RemoteAddr), network: "http"}
+	if r.TLS != nil {
+		writer.network = "https"
+	}
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		writer.local = local
+	}
+
+	handler.ServeDNS(writer, query)
+	return writer.msg
+}
+
+// MinTTL returns the smallest TTL of the records of the response, which bounds how long it may be cached.
+// The answer section is used if it holds records, otherwise the authority section, whose SOA limits the
+// caching of negative responses. Responses without records yield 0.
+func MinTTL(response *dns.Message) uint32 {
+	for _, section := range [][]dns.Answer{response.Answers, response.Authority} {
+		minTTL, found := uint32(0), false
+		for _, record := range section {
+			if record.Type == dns.TypeOPT {
+				continue
+			}
+			if !found || record.TTL < minTTL {
+				minTTL, found = record.TTL, true
+			}
+		}
+		if found {
+			return minTTL
+		}
+	}
+	return 0
+}
+
+// responseWriter remembers the response of a dns.Handler so it can be sent in an HTTP response.
+type responseWriter struct {
+	local   net.Addr
+	remote  net.Addr
+	network string
+	msg     *dns.Message
+}
+
+func (w *responseWriter) LocalAddr() net.Addr  { return w.local }
+func (w *responseWriter) RemoteAddr() net.Addr { return w.remote }
+func (w *responseWriter) Network() string      { return w.network }
+
+func (w *responseWriter) WriteMsg(m *dns.Message) error {
+	w.msg = m
+	return nil
+}
+
+// addr parses the ip:port remote address of an HTTP request. It never resolves names,
+// addresses which are not literal yield nil.
+func addr(address string) net.Addr {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return nil
+	}
+	return net.TCPAddrFromAddrPort(addrPort)
+}
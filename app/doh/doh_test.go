@@ -0,0 +1,161 @@
+package doh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testDNSHandler answers A queries with two records of different TTLs and everything else with
+// NXDOMAIN and a SOA record. It remembers the writer of the last query.
+type testDNSHandler struct {
+	last dns.ResponseWriter
+}
+
+func (h *testDNSHandler) ServeDNS(w dns.ResponseWriter, r *dns.Message) {
+	h.last = w
+	response := dns.NewResponse(r)
+	if r.Questions[0].Type == dns.TypeA {
+		response.Answers = []dns.Answer{
+			{Name: "example.com", Type: dns.TypeA, Class: dns.ClassIN, TTL: 300, RData: &dns.A{IP: net.IPv4(192, 0, 2, 1).To4()}},
+			{Name: "example.com", Type: dns.TypeA, Class: dns.ClassIN, TTL: 60, RData: &dns.A{IP: net.IPv4(192, 0, 2, 2).To4()}},
+		}
+	} else {
+		response.Header.RCode = dns.RCodeNameError
+		response.Authority = []dns.Answer{{
+			Name: "example.com", Type: dns.TypeSOA, Class: dns.ClassIN, TTL: 900,
+			RData: &dns.SOA{MName: "ns1.example.com", RName: "hostmaster.example.com", Minimum: 120},
+		}}
+	}
+	_ = w.WriteMsg(response)
+}
+
+// encodedQuery returns the wire format of a query for example.com.
+func encodedQuery(t *testing.T, rrType dns.Type) []byte {
+	t.Helper()
+
+	query := &dns.Message{
+		Header:    dns.Header{ID: 0, RD: true},
+		Questions: []dns.Question{{Name: "example.com", Type: rrType, Class: dns.ClassIN}},
+	}
+	packet, err := query.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+// serveHTTP passes the request to a Handler and returns the recorded HTTP response.
+func serveHTTP(handler dns.Handler, r *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	NewHandler(handler).ServeHTTP(recorder, r)
+	return recorder
+}
+
+// decodeResponse checks that the HTTP response carries a DNS message and decodes it.
+func decodeResponse(t *testing.T, recorder *httptest.ResponseRecorder) *dns.Message {
+	t.Helper()
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got HTTP status %d: %s", recorder.Code, recorder.Body)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != ContentType {
+		t.Errorf("got content type '%s', expected %s", contentType, ContentType)
+	}
+	response, err := dns.UnMarshallMessage(recorder.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestHandlerGet(t *testing.T) {
+	handler := &testDNSHandler{}
+	encoded := base64.RawURLEncoding.EncodeToString(encodedQuery(t, dns.TypeA))
+	r := httptest.NewRequest(http.MethodGet, "https://dns.example"+Path+"?dns="+encoded, nil)
+	r.RemoteAddr = "192.0.2.53:4321"
+
+	recorder := serveHTTP(handler, r)
+	response := decodeResponse(t, recorder)
+	if len(response.Answers) != 2 {
+		t.Errorf("got %d answers, expected 2", len(response.Answers))
+	}
+	if cacheControl := recorder.Header().Get("Cache-Control"); cacheControl != "max-age=60" {
+		t.Errorf("got Cache-Control '%s', expected the smallest TTL max-age=60", cacheControl)
+	}
+
+	if network := handler.last.Network(); network != "https" {
+		t.Errorf("handler saw network '%s' for a request over TLS, expected https", network)
+	}
+	if remote := handler.last.RemoteAddr(); remote == nil || remote.String() != "192.0.2.53:4321" {
+		t.Errorf("handler saw remote address %v, expected 192.0.2.53:4321", remote)
+	}
+}
+
+func TestHandlerPost(t *testing.T) {
+	handler := &testDNSHandler{}
+	r := httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(encodedQuery(t, dns.TypeMX)))
+	r.Header.Set("Content-Type", ContentType)
+	r.RemoteAddr = "localhost:4321"
+
+	recorder := serveHTTP(handler, r)
+	response := decodeResponse(t, recorder)
+	if response.Header.RCode != dns.RCodeNameError {
+		t.Errorf("got rcode %d, expected NXDOMAIN", response.Header.RCode)
+	}
+	// Negative responses are cached as long as their SOA record
+	if cacheControl := recorder.Header().Get("Cache-Control"); cacheControl != "max-age=900" {
+		t.Errorf("got Cache-Control '%s', expected max-age=900", cacheControl)
+	}
+
+	if network := handler.last.Network(); network != "http" {
+		t.Errorf("handler saw network '%s' for a plain HTTP request, expected http", network)
+	}
+	if remote := handler.last.RemoteAddr(); remote != nil {
+		t.Errorf("handler saw remote address %v for a host name, expected nil", remote)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	query := encodedQuery(t, dns.TypeA)
+	response := append([]byte(nil), query...)
+	response[2] |= 0x80
+
+	post := func(contentType string, body []byte) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		return r
+	}
+	get := func(parameter string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, Path+"?dns="+parameter, nil)
+	}
+
+	tests := []struct {
+		description string
+		request     *http.Request
+		status      int
+	}{
+		{"wrong content type", post("text/plain", query), http.StatusUnsupportedMediaType},
+		{"missing content type", post("", query), http.StatusUnsupportedMediaType},
+		{"malformed POST query", post(ContentType, []byte{1, 2, 3}), http.StatusBadRequest},
+		{"POST response", post(ContentType, response), http.StatusBadRequest},
+		{"oversized POST query", post(ContentType, make([]byte, maxMessageSize+1)), http.StatusRequestEntityTooLarge},
+		{"missing dns parameter", httptest.NewRequest(http.MethodGet, Path, nil), http.StatusBadRequest},
+		{"invalid base64url", get("not*base64"), http.StatusBadRequest},
+		{"malformed GET query", get(base64.RawURLEncoding.EncodeToString([]byte{1, 2, 3})), http.StatusBadRequest},
+		{"other method", httptest.NewRequest(http.MethodPut, Path, nil), http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		recorder := serveHTTP(&testDNSHandler{}, test.request)
+		if recorder.Code != test.status {
+			body, _ := io.ReadAll(recorder.Body)
+			t.Errorf("%s: got HTTP status %d (%s), expected %d", test.description, recorder.Code, body, test.status)
+		}
+	}
+}
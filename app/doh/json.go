@@ -0,0 +1,197 @@
+package doh
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// JSONContentType is the media type of the JSON API responses.
+	JSONContentType = "application/dns-json"
+
+	// JSONPath is the conventional path of the JSON API.
+	JSONPath = "/resolve"
+)
+
+// JSONHandler serves the JSON DNS API popularized by Google Public DNS and Cloudflare:
+//
+//	GET /resolve?name=example.com&type=AAAA
+//
+// The query parameters are:
+//
+// - name: The domain name to resolve, required.
+//
+// - type: The record type as a mnemonic such as "AAAA" or a number. Defaults to A.
+//
+// - cd: Set to 1 or true to disable DNSSEC validation.
+//
+// - do: Set to 1 or true to ask for DNSSEC records.
+//
+// The response holds the status, the header flags and the question and record sections with
+// the record data in presentation format, for example:
+//
+//	{"Status":0,"TC":false,"RD":true,"RA":true,"AD":false,"CD":false,
+//	 "Question":[{"name":"example.com.","type":28}],
+//	 "Answer":[{"name":"example.com.","type":28,"TTL":300,"data":"2001:db8::1"}]}
+type JSONHandler struct {
+	DNS dns.Handler
+}
+
+// NewJSONHandler creates a JSONHandler answering queries with the given dns.Handler.
+//
+// Parameters:
+// - handler: The handler answering the queries.
+//
+// Returns:
+// - A pointer to the JSONHandler.
+func NewJSONHandler(handler dns.Handler) *JSONHandler {
+	return &JSONHandler{DNS: handler}
+}
+
+// jsonResponse is a response of the JSON API.
+type jsonResponse struct {
+	Status    uint16         `json:"Status"`
+	TC        bool           `json:"TC"`
+	RD        bool           `json:"RD"`
+	RA        bool           `json:"RA"`
+	AD        bool           `json:"AD"`
+	CD        bool           `json:"CD"`
+	Question  []jsonQuestion `json:"Question"`
+	Answer    []jsonRecord   `json:"Answer,omitempty"`
+	Authority []jsonRecord   `json:"Authority,omitempty"`
+}
+
+type jsonQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+type jsonRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+func (h *JSONHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := parseJSONQuery(r)
+	if err != nil {
+		writeJSONError(w, err.Error())
+		return
+	}
+
+	response := Exchange(h.DNS, r, query)
+	if response == nil {
+		http.Error(w, "no DNS response", http.StatusBadGateway)
+		return
+	}
+
+	encoded, err := json.Marshal(toJSONResponse(response))
+	if err != nil {
+		fmt.Println("Failed to marshal response:", err)
+		http.Error(w, "failed to encode DNS response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", JSONContentType)
+	w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(MinTTL(response)), 10))
+	if _, err := w.Write(encoded); err != nil {
+		fmt.Println("Failed to send response:", err)
+	}
+}
+
+// parseJSONQuery builds the DNS query described by the parameters of a JSON API request.
+func parseJSONQuery(r *http.Request) (*dns.Message, error) {
+	parameters := r.URL.Query()
+
+	name := parameters.Get("name")
+	if name == "" || len(name) > 254 {
+		return nil, fmt.Errorf("invalid name '%s'", name)
+	}
+
+	rrType := dns.TypeA
+	if value := parameters.Get("type"); value != "" {
+		if number, err := strconv.ParseUint(value, 10, 16); err == nil {
+			rrType = dns.Type(number)
+		} else if rrType, err = dns.ParseType(value); err != nil {
+			return nil, err
+		}
+	}
+
+	qname, err := dns.QualifyName(name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	query := &dns.Message{
+		Header:    dns.Header{RD: true, CD: isTrue(parameters.Get("cd"))},
+		Questions: []dns.Question{{Name: qname, Type: rrType, Class: dns.ClassIN}},
+	}
+	if isTrue(parameters.Get("do")) {
+		query.SetEDNS(&dns.EDNS{UDPSize: dns.DefaultEDNSUDPSize, DO: true})
+	}
+	return query, nil
+}
+
+// toJSONResponse converts a DNS response to its JSON API form. The OPT record is left out.
+func toJSONResponse(response *dns.Message) jsonResponse {
+	converted := jsonResponse{
+		Status: response.RCode(),
+		TC:     response.Header.TC,
+		RD:     response.Header.RD,
+		RA:     response.Header.RA,
+		AD:     response.Header.AD,
+		CD:     response.Header.CD,
+	}
+
+	for _, question := range response.Questions {
+		converted.Question = append(converted.Question, jsonQuestion{Name: dns.FQDN(question.Name), Type: uint16(question.Type)})
+	}
+
+	records := func(section []dns.Answer) []jsonRecord {
+		var converted []jsonRecord
+		for _, record := range section {
+			if record.Type == dns.TypeOPT {
+				continue
+			}
+			data := ""
+			if record.RData != nil {
+				data = record.RData.String()
+			}
+			converted = append(converted, jsonRecord{
+				Name: dns.FQDN(record.Name),
+				Type: uint16(record.Type),
+				TTL:  record.TTL,
+				Data: data,
+			})
+		}
+		return converted
+	}
+	converted.Answer = records(response.Answers)
+	converted.Authority = records(response.Authority)
+	return converted
+}
+
+// writeJSONError answers a request the API cannot turn into a query with HTTP 400 and an error object.
+func writeJSONError(w http.ResponseWriter, message string) {
+	encoded, _ := json.Marshal(map[string]string{"error": message})
+
+	w.Header().Set("Content-Type", JSONContentType)
+	w.WriteHeader(http.StatusBadRequest)
+	if _, err := w.Write(encoded); err != nil {
+		fmt.Println("Failed to send response:", err)
+	}
+}
+
+// isTrue reports whether a query parameter enables an option.
+func isTrue(value string) bool {
+	return value == "1" || value == "true"
+}
@@ -0,0 +1,22 @@
+package doh
+
+import (
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"testing"
+)
+
+func TestToJSONResponseRecordWithoutData(t *testing.T) {
+	response := &dns.Message{
+		Header:    dns.Header{ID: 1, QR: true},
+		Questions: []dns.Question{{Name: "example.com", Type: dns.TypeTXT, Class: dns.ClassIN}},
+		Answers:   []dns.Answer{{Name: "example.com", Type: dns.TypeTXT, Class: dns.ClassIN, TTL: 60}},
+	}
+
+	converted := toJSONResponse(response)
+	if len(converted.Answer) != 1 {
+		t.Fatalf("got %d answers, expected 1", len(converted.Answer))
+	}
+	if record := converted.Answer[0]; record.Name != "example.com." || record.Data != "" {
+		t.Errorf("record without data converted to %+v, expected empty data", record)
+	}
+}
@@ -1,64 +1,160 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"github.com/codecrafters-io/dns-server-starter-go/app/debug"
-	"github.com/codecrafters-io/dns-server-starter-go/app/resolve"
-	"net"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"github.com/codecrafters-io/dns-server-starter-go/app/doh"
+	"github.com/codecrafters-io/dns-server-starter-go/app/plugin"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
-func readFromConnection(udpConn *net.UDPConn, toAddress string) {
-	buf := make([]byte, 512)
-
-	var resolver *net.Resolver
-	fmt.Println("Resolver address:", toAddress)
-	if toAddress != "" {
-		resolver = resolve.NewResolver(toAddress)
-	}
+// Timeouts of the DNS over HTTPS server, so slow or idle clients cannot hold connections open forever.
+// The write timeout starts once the request has been read and also covers resolving the query.
+const (
+	httpReadHeaderTimeout = 5 * time.Second
+	httpReadTimeout       = 10 * time.Second
+	httpWriteTimeout      = 30 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
 
-	for {
-		size, source, err := udpConn.ReadFromUDP(buf)
-		if err != nil {
-			fmt.Println("Error receiving data:", err)
-			break
+// loadDirectives reads the plugin configuration from configPath. Without a configuration file
+// names matching a forwarding rule of the form SUFFIX=ADDRESS[,ADDRESS...] are forwarded to the
+// upstreams of the rule, and every other name to the comma separated upstreams of toAddress,
+// or resolved from the root servers if recursive is set. If no resolver is given either,
+// the chain is empty and every query is refused.
+func loadDirectives(configPath, toAddress string, forwardRules []string, recursive bool) ([]plugin.Directive, error) {
+	if configPath == "" {
+		var directives []plugin.Directive
+		for _, rule := range forwardRules {
+			zone, addresses, ok := strings.Cut(rule, "=")
+			if !ok || zone == "" || addresses == "" {
+				return nil, fmt.Errorf("invalid forwarding rule '%s', expected SUFFIX=ADDRESS[,ADDRESS...]", rule)
+			}
+			fmt.Println("Forwarding", zone, "to", addresses)
+			args := append(strings.Split(addresses, ","), "zone="+zone)
+			directives = append(directives, plugin.Directive{Name: "forward", Args: args})
 		}
 
-		debug.ShowDNsPacketAsHex(buf[:size])
-		message, err := resolve.HandleDnsResolution(buf[:size], resolver)
+		if recursive {
+			if toAddress != "" {
+				return nil, fmt.Errorf("-recursive cannot be combined with -resolver")
+			}
+			fmt.Println("Resolving recursively from the root servers")
+			return append(directives, plugin.Directive{Name: "recursive"}), nil
+		}
 
-		if err != nil {
-			fmt.Println("Failed to unmarshal message:", err)
-			continue
+		fmt.Println("Resolver address:", toAddress)
+		if toAddress != "" {
+			directives = append(directives, plugin.Directive{Name: "forward", Args: strings.Split(toAddress, ",")})
 		}
-		_, err = udpConn.WriteToUDP(message.Marshal(), source)
+		return directives, nil
+	}
+	if len(forwardRules) > 0 {
+		return nil, fmt.Errorf("-forward cannot be combined with -config, use forward directives with zone= instead")
+	}
+
+	file, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
 		if err != nil {
-			fmt.Println("Failed to send response:", err)
+			fmt.Println("Failed to close configuration:", err)
 		}
-	}
+	}(file)
+
+	return plugin.ParseConfig(file)
 }
 
 func main() {
 
-	toAddress := flag.String("resolver", "", "Resolver address")
+	listenAddress := flag.String("address", "127.0.0.1:2053", "Address to listen on, use [::1]:2053 for IPv6 or [::]:2053 for every IPv4 and IPv6 address")
+	toAddress := flag.String("resolver", "", "Comma separated resolver addresses, such as 8.8.8.8:53,[2001:4860:4860::8888]:53")
+	recursive := flag.Bool("recursive", false, "Resolve names iteratively from the root servers instead of forwarding them to a resolver")
+	var forwardRules []string
+	flag.Func("forward", "Forward a domain suffix to its own resolvers, such as corp.internal=10.0.0.1,10.0.0.2 (may be repeated)", func(rule string) error {
+		forwardRules = append(forwardRules, rule)
+		return nil
+	})
+	tlsAddress := flag.String("tls-address", "", "Address to serve DNS over TLS on, such as 127.0.0.1:853 (requires -tls-cert and -tls-key)")
+	certFile := flag.String("tls-cert", "", "PEM encoded certificate for DNS over TLS and HTTPS")
+	keyFile := flag.String("tls-key", "", "PEM encoded private key for DNS over TLS and HTTPS")
+	dohAddress := flag.String("doh-address", "", "Address to serve DNS over HTTPS on at "+doh.Path+" and the JSON API at "+doh.JSONPath+", such as 127.0.0.1:8443 (plain HTTP without -tls-cert and -tls-key)")
+	configPath := flag.String("config", "", "Plugin configuration file, one plugin per line (available: "+strings.Join(plugin.Names(), ", ")+")")
 	flag.Parse()
-	udpAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:2053")
+
+	directives, err := loadDirectives(*configPath, *toAddress, forwardRules, *recursive)
 	if err != nil {
-		fmt.Println("Failed to resolve UDP address:", err)
+		fmt.Println("Failed to load configuration:", err)
 		return
 	}
 
-	udpConn, err := net.ListenUDP("udp", udpAddr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := plugin.Build(ctx, directives)
 	if err != nil {
-		fmt.Println("Failed to bind to address:", err)
+		fmt.Println("Failed to set up plugins:", err)
 		return
 	}
-	defer func(udpConn *net.UDPConn) {
-		err := udpConn.Close()
-		if err != nil {
-			fmt.Println("Failed to close UDP connection:", err)
+
+	mux := dns.NewServeMux()
+	mux.Handle(".", handler)
+
+	if (*tlsAddress != "" || *dohAddress != "") && (*certFile == "") != (*keyFile == "") {
+		fmt.Println("-tls-cert and -tls-key must be given together")
+		return
+	}
+	if *tlsAddress != "" && *certFile == "" {
+		fmt.Println("-tls-address requires -tls-cert and -tls-key")
+		return
+	}
+
+	server := &dns.Server{
+		Addr:    *listenAddress,
+		Handler: mux,
+	}
+
+	errs := make(chan error, 3)
+	go func() { errs <- server.ListenAndServe() }()
+
+	if *tlsAddress != "" {
+		tlsServer := &dns.Server{
+			Addr:    *tlsAddress,
+			Handler: mux,
 		}
-	}(udpConn)
+		fmt.Println("Serving DNS over TLS on", *tlsAddress)
+		go func() { errs <- tlsServer.ListenAndServeTLS(*certFile, *keyFile) }()
+	}
+
+	if *dohAddress != "" {
+		httpMux := http.NewServeMux()
+		httpMux.Handle(doh.Path, doh.NewHandler(mux))
+		httpMux.Handle(doh.JSONPath, doh.NewJSONHandler(mux))
+		httpServer := &http.Server{
+			Addr:              *dohAddress,
+			Handler:           httpMux,
+			ReadHeaderTimeout: httpReadHeaderTimeout,
+			ReadTimeout:       httpReadTimeout,
+			WriteTimeout:      httpWriteTimeout,
+			IdleTimeout:       httpIdleTimeout,
+		}
+
+		fmt.Println("Serving DNS over HTTPS on", *dohAddress+doh.Path, "and the JSON API on", *dohAddress+doh.JSONPath)
+		go func() {
+			if *certFile == "" {
+				errs <- httpServer.ListenAndServe()
+			} else {
+				errs <- httpServer.ListenAndServeTLS(*certFile, *keyFile)
+			}
+		}()
+	}
 
-	readFromConnection(udpConn, *toAddress)
+	fmt.Println("Server stopped:", <-errs)
 }
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/cache"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	// defaultCacheSize is the number of responses cached when no size is configured.
+	defaultCacheSize = 10000
+
+	// defaultPrefetchWindow is how close to expiring popular responses are prefetched when no window is configured.
+	defaultPrefetchWindow = 10 * time.Second
+)
+
+func init() {
+	Register("cache", setupCache)
+}
+
+// setupCache configures the cache plugin, which answers repeated questions from memory
+// and caches the responses the rest of the chain produces:
+//
+//	cache [size=ENTRIES] [min_ttl=DURATION] [max_ttl=DURATION] [negative_ttl=DURATION]
+//	      [stale=DURATION] [stale_ttl=DURATION] [prefetch=HITS] [prefetch_window=DURATION] [stats=DURATION]
+//
+// Durations are written like "30s" or "1h". negative_ttl limits how long NXDOMAIN and NODATA responses are cached.
+//
+// stale enables serve-stale (RFC 8767): expired responses are still answered for that long, with records
+// carrying stale_ttl (30s by default), while the rest of the chain refreshes them in the background.
+// prefetch refreshes responses which were served at least HITS times once they expire within prefetch_window.
+// stats logs the hit and miss counters of the cache at the given interval until the context of the chain is cancelled.
+func setupCache(ctx context.Context, args []string) (Plugin, error) {
+	options, err := parseOptions(args, "size", "min_ttl", "max_ttl", "negative_ttl",
+		"stale", "stale_ttl", "prefetch", "prefetch_window", "stats")
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := intOption(options, "size", defaultCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := cache.New(size)
+	if responses.MinTTL, err = durationOption(options, "min_ttl", responses.MinTTL); err != nil {
+		return nil, err
+	}
+	if responses.MaxTTL, err = durationOption(options, "max_ttl", responses.MaxTTL); err != nil {
+		return nil, err
+	}
+	if responses.MaxNegativeTTL, err = durationOption(options, "negative_ttl", responses.MaxNegativeTTL); err != nil {
+		return nil, err
+	}
+	if responses.MaxTTL > 0 && responses.MinTTL > responses.MaxTTL {
+		return nil, fmt.Errorf("min_ttl %s exceeds max_ttl %s", responses.MinTTL, responses.MaxTTL)
+	}
+	if responses.StaleWindow, err = durationOption(options, "stale", responses.StaleWindow); err != nil {
+		return nil, err
+	}
+	if responses.StaleAnswerTTL, err = durationOption(options, "stale_ttl", responses.StaleAnswerTTL); err != nil {
+		return nil, err
+	}
+	if responses.PrefetchHits, err = intOption(options, "prefetch", responses.PrefetchHits); err != nil {
+		return nil, err
+	}
+	if responses.PrefetchWindow, err = durationOption(options, "prefetch_window", defaultPrefetchWindow); err != nil {
+		return nil, err
+	}
+	statsInterval, err := durationOption(options, "stats", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next dns.Handler) dns.Handler {
+		if statsInterval > 0 {
+			go responses.LogStats(ctx, statsInterval)
+		}
+		return &cacheHandler{cache: responses, next: next}
+	}, nil
+}
+
+// cacheHandler serves queries from the cache and fills it with the responses of the next handler.
+// Stale and soon expiring responses are refreshed by the next handler in the background.
+type cacheHandler struct {
+	cache *cache.Cache
+	next  dns.Handler
+}
+
+func (h *cacheHandler) ServeDNS(w dns.ResponseWriter, r *dns.Message) {
+	if len(r.Questions) != 1 {
+		h.next.ServeDNS(w, r)
+		return
+	}
+
+	key := cache.KeyOf(r.Questions[0])
+	if result := h.cache.Lookup(key); result.Status != cache.Miss {
+		if err := w.WriteMsg(cachedResponse(r, result.Response)); err != nil {
+			fmt.Println("Failed to send response:", err)
+		}
+		if result.Refresh {
+			go h.refresh(key, w, r)
+		}
+		return
+	}
+
+	recorder := NewRecorder(w)
+	h.next.ServeDNS(recorder, r)
+	if recorder.Msg != nil {
+		h.cache.Set(key, recorder.Msg)
+	}
+}
+
+// refresh resolves the query again with the next handler and caches the new response.
+// The response is not sent to the client, which was already answered from the cache.
+// If the refresh fails, Set ignores the error response and the old response stays cached.
+// It runs on its own goroutine, out of reach of the panic recovery of dns.Server, so it recovers itself.
+func (h *cacheHandler) refresh(key cache.Key, w dns.ResponseWriter, r *dns.Message) {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Printf("Handler panicked refreshing %s %s: %v\n%s", key.Name, key.Type, err, debug.Stack())
+		}
+	}()
+
+	recorder := NewRecorder(discardWriter{ResponseWriter: w})
+	h.next.ServeDNS(recorder, r)
+	if recorder.Msg != nil {
+		h.cache.Set(key, recorder.Msg)
+	}
+}
+
+// cachedResponse builds the response to a query from a cached response.
+func cachedResponse(query, cached *dns.Message) *dns.Message {
+	response := dns.NewResponse(query)
+	response.Header.RA = cached.Header.RA
+	response.Header.RCode = cached.Header.RCode
+	response.Answers = cached.Answers
+	response.Authority = cached.Authority
+	response.Additional = append(cached.Additional, response.Additional...)
+	return response
+}
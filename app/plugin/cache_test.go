@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"context"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// addressHandler answers A queries with 192.0.2.N for the Nth query it sees, after calling before with N.
+func addressHandler(before func(n int32)) dns.Handler {
+	var queries atomic.Int32
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		n := queries.Add(1)
+		before(n)
+
+		response := dns.NewResponse(r)
+		response.Answers = []dns.Answer{{
+			Name: r.Questions[0].Name, Type: dns.TypeA, Class: dns.ClassIN, TTL: 300,
+			RData: &dns.A{IP: net.IPv4(192, 0, 2, byte(n)).To4()},
+		}}
+		_ = w.WriteMsg(response)
+	})
+}
+
+// answerOf returns the data of the first answer of the response to an A query for example.com.
+func answerOf(t *testing.T, handler dns.Handler) string {
+	t.Helper()
+
+	response := serve(handler, "example.com", dns.TypeA)
+	if response == nil || len(response.Answers) == 0 {
+		t.Fatalf("got response %+v, expected an answer", response)
+	}
+	return response.Answers[0].RData.String()
+}
+
+func TestCachePrefetchRefreshesInBackground(t *testing.T) {
+	cachePlugin, err := setupCache(context.Background(), []string{"prefetch=1", "prefetch_window=1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Chain([]Plugin{cachePlugin}, addressHandler(func(int32) {}))
+
+	if got := answerOf(t, handler); got != "192.0.2.1" {
+		t.Fatalf("first query answered with %s", got)
+	}
+	// Served from the cache, and within the prefetch window of the popular entry
+	if got := answerOf(t, handler); got != "192.0.2.1" {
+		t.Fatalf("cached query answered with %s", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for answerOf(t, handler) != "192.0.2.2" {
+		if time.Now().After(deadline) {
+			t.Fatal("the prefetched response never replaced the cached one")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCacheRefreshRecoversFromPanics(t *testing.T) {
+	cachePlugin, err := setupCache(context.Background(), []string{"prefetch=1", "prefetch_window=1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshing := make(chan struct{})
+	handler := Chain([]Plugin{cachePlugin}, addressHandler(func(n int32) {
+		if n == 2 {
+			close(refreshing)
+			panic("refresh failed")
+		}
+	}))
+
+	answerOf(t, handler)
+	answerOf(t, handler)
+	select {
+	case <-refreshing:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no refresh started")
+	}
+
+	// An unrecovered panic would have ended the test binary by now
+	time.Sleep(50 * time.Millisecond)
+	if got := answerOf(t, handler); got != "192.0.2.1" {
+		t.Errorf("after a failed refresh the query was answered with %s, expected the cached 192.0.2.1", got)
+	}
+}
+
+func TestSetupCacheErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"size=0"},
+		{"min_ttl=1h", "max_ttl=1m"},
+		{"stale=soon"},
+		{"stats=-1s"},
+		{"colour=blue"},
+	} {
+		if _, err := setupCache(context.Background(), args); err == nil {
+			t.Errorf("setup with %v succeeded, expected an error", args)
+		}
+	}
+}
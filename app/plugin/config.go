@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directive is one line of a plugin configuration: the name of a plugin followed by its arguments.
+type Directive struct {
+	Name string
+	Args []string
+	Line int
+}
+
+// ParseConfig reads a plugin configuration. Every non-empty line configures one plugin
+// and lists its name followed by its arguments, separated by whitespace. Text after a '#' is a comment.
+// Plugins process queries in the order they are listed, for example:
+//
+//	# answer from the local table first, then ask the upstream
+//	static 10.0.0.1
+//	forward 8.8.8.8:53
+//
+// Parameters:
+// - r: The configuration to read.
+//
+// Returns:
+// - The directives in the order they appear.
+// - An error if reading fails.
+func ParseConfig(r io.Reader) ([]Directive, error) {
+	var directives []Directive
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+		if comment := strings.IndexByte(text, '#'); comment >= 0 {
+			text = text[:comment]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		directives = append(directives, Directive{
+			Name: fields[0],
+			Args: fields[1:],
+			Line: line,
+		})
+	}
+
+	return directives, scanner.Err()
+}
+
+// splitArgs separates the positional arguments of a directive from its key=value options.
+func splitArgs(args []string) (positional, options []string) {
+	for _, arg := range args {
+		if strings.Contains(arg, "=") {
+			options = append(options, arg)
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	return positional, options
+}
+
+// parseOptions parses plugin arguments of the form key=value.
+//
+// Parameters:
+// - args: The arguments of the directive.
+// - allowed: The keys the plugin understands.
+//
+// Returns:
+// - The values by key.
+// - An error if an argument is not of the form key=value or uses an unknown key.
+func parseOptions(args []string, allowed ...string) (map[string]string, error) {
+	options := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got '%s'", arg)
+		}
+		if !slices.Contains(allowed, key) {
+			return nil, fmt.Errorf("unknown option '%s', expected one of %s", key, strings.Join(allowed, ", "))
+		}
+		options[key] = value
+	}
+	return options, nil
+}
+
+// durationOption parses the option with the given key as a duration such as "30s" or "1h".
+// It returns fallback if the option is not set.
+func durationOption(options map[string]string, key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := options[key]
+	if !ok {
+		return fallback, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("option '%s': invalid duration '%s'", key, value)
+	}
+	return duration, nil
+}
+
+// intOption parses the option with the given key as a positive integer.
+// It returns fallback if the option is not set.
+func intOption(options map[string]string, key string, fallback int) (int, error) {
+	value, ok := options[key]
+	if !ok {
+		return fallback, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("option '%s': invalid positive number '%s'", key, value)
+	}
+	return number, nil
+}
@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"github.com/codecrafters-io/dns-server-starter-go/app/resolve"
+	"time"
+)
+
+// defaultHealthCheckInterval is how often upstreams are probed when no interval is configured.
+const defaultHealthCheckInterval = 10 * time.Second
+
+func init() {
+	Register("forward", setupForward)
+}
+
+// setupForward configures the forward plugin, which relays queries to one of a list of upstream servers
+// and passes their responses back unchanged:
+//
+//	forward ADDRESS... [zone=SUFFIX] [policy=POLICY] [timeout=DURATION] [max_fails=COUNT] [eject=DURATION] [health_check=DURATION]
+//
+// zone limits the plugin to the names inside the given domain, "." (every name) by default.
+// Consecutive forward directives form a single set of rules and each query goes to the rule with
+// the longest zone containing its name, whatever the order of the lines, for example:
+//
+//	forward 10.0.0.1 10.0.0.2 zone=corp.internal timeout=1s
+//	forward 8.8.8.8 1.1.1.1
+//
+// The addresses may be IPv4 or IPv6 addresses, with or without a port, such as "8.8.8.8" or "[::1]:53".
+// policy is one of round_robin (the default), random, lowest_latency or strict_order. timeout limits
+// the exchange with a single upstream. An upstream failing max_fails times in a row (2 by default) is
+// ejected for eject (30s by default). Every upstream is probed each health_check interval (10s by default,
+// 0s disables the probes) until the context of the chain is cancelled.
+//
+// Queries outside every zone are passed on to the next handler.
+func setupForward(ctx context.Context, args []string) (Plugin, error) {
+	addresses, optionArgs := splitArgs(args)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("expected at least one upstream address")
+	}
+
+	options, err := parseOptions(optionArgs, "zone", "policy", "timeout", "max_fails", "eject", "health_check")
+	if err != nil {
+		return nil, err
+	}
+
+	for i, address := range addresses {
+		if addresses[i], err = resolve.ParseUpstream(address); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := resolve.NewPool(addresses)
+	if policy, ok := options["policy"]; ok {
+		if pool.Policy, err = resolve.ParsePolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+	if pool.MaxFails, err = intOption(options, "max_fails", pool.MaxFails); err != nil {
+		return nil, err
+	}
+	if pool.EjectTimeout, err = durationOption(options, "eject", pool.EjectTimeout); err != nil {
+		return nil, err
+	}
+
+	timeout, err := durationOption(options, "timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, upstream := range pool.Upstreams {
+		upstream.Timeout = timeout
+	}
+
+	interval, err := durationOption(options, "health_check", defaultHealthCheckInterval)
+	if err != nil {
+		return nil, err
+	}
+	zone := options["zone"]
+	if zone == "" {
+		zone = "."
+	}
+
+	return func(next dns.Handler) dns.Handler {
+		if interval > 0 {
+			go pool.HealthCheck(ctx, interval)
+		}
+
+		// The chain is built from the last plugin to the first, so a forward directive
+		// followed by another one adds its rule to the rules of the later directives
+		rules, ok := next.(*forwardRules)
+		if !ok {
+			rules = &forwardRules{zones: dns.NewServeMux(), next: next}
+		}
+		rules.zones.Handle(zone, pool)
+		return rules
+	}, nil
+}
+
+// forwardRules sends each query to the upstreams of the longest zone containing its name.
+// Queries outside every zone go to the next handler.
+type forwardRules struct {
+	zones *dns.ServeMux
+	next  dns.Handler
+}
+
+func (f *forwardRules) ServeDNS(w dns.ResponseWriter, r *dns.Message) {
+	if len(r.Questions) == 1 {
+		if pool := f.zones.Handler(r.Questions[0].Name); pool != nil {
+			pool.ServeDNS(w, r)
+			return
+		}
+	}
+	f.next.ServeDNS(w, r)
+}
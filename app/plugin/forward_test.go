@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"context"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startUpstream serves DNS over UDP and TCP on the same free loopback port and returns its address.
+func startUpstream(t *testing.T, handler dns.Handler) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		_ = listener.Close()
+		t.Fatal(err)
+	}
+
+	server := &dns.Server{Handler: handler}
+	go server.ServeUDP(conn)
+	go server.ServeTCP(listener)
+	t.Cleanup(server.Shutdown)
+	return listener.Addr().String()
+}
+
+// fixedAddressUpstream starts an upstream answering every A query with ip after delay.
+func fixedAddressUpstream(t *testing.T, ip string, delay time.Duration) string {
+	t.Helper()
+
+	return startUpstream(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		time.Sleep(delay)
+		response := dns.NewResponse(r)
+		response.Answers = []dns.Answer{{
+			Name: r.Questions[0].Name, Type: dns.TypeA, Class: dns.ClassIN, TTL: 60,
+			RData: &dns.A{IP: net.ParseIP(ip).To4()},
+		}}
+		response.Header.ANCount = 1
+		_ = w.WriteMsg(response)
+	}))
+}
+
+// buildConfig builds the chain of a configuration for the test.
+func buildConfig(t *testing.T, config string) dns.Handler {
+	t.Helper()
+
+	directives, err := ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	handler, err := Build(ctx, directives)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+func TestForwardLongestZoneWins(t *testing.T) {
+	corp := fixedAddressUpstream(t, "10.0.0.1", 0)
+	public := fixedAddressUpstream(t, "8.8.8.8", 0)
+
+	configs := map[string]string{
+		"default rule first": "forward " + public + " health_check=0s\n" +
+			"forward " + corp + " zone=corp.internal health_check=0s\n",
+		"default rule last": "forward " + corp + " zone=corp.internal health_check=0s\n" +
+			"forward " + public + " health_check=0s\n",
+	}
+	want := map[string]string{
+		"corp.internal":     "10.0.0.1",
+		"x.corp.internal":   "10.0.0.1",
+		"X.Corp.Internal.":  "10.0.0.1",
+		"notcorp.internal":  "8.8.8.8",
+		"internal":          "8.8.8.8",
+		"example.com":       "8.8.8.8",
+		"corp.internal.com": "8.8.8.8",
+	}
+
+	for description, config := range configs {
+		handler := buildConfig(t, config)
+		for name, address := range want {
+			response := serve(handler, name, dns.TypeA)
+			if response == nil || len(response.Answers) != 1 {
+				t.Errorf("%s: %s answered with %+v", description, name, response)
+				continue
+			}
+			if got := response.Answers[0].RData.String(); got != address {
+				t.Errorf("%s: %s was forwarded to the upstream answering %s, expected %s", description, name, got, address)
+			}
+		}
+	}
+}
+
+func TestForwardOutsideEveryZonePassesOn(t *testing.T) {
+	corp := fixedAddressUpstream(t, "10.0.0.1", 0)
+	handler := buildConfig(t, "forward "+corp+" zone=corp.internal health_check=0s\n")
+
+	if response := serve(handler, "example.com", dns.TypeA); response == nil || response.Header.RCode != dns.RCodeRefused {
+		t.Errorf("name outside the forwarded zone answered with %+v, expected REFUSED from the end of the chain", response)
+	}
+}
+
+func TestForwardTimeoutPerRule(t *testing.T) {
+	slow := fixedAddressUpstream(t, "10.0.0.1", 500*time.Millisecond)
+	public := fixedAddressUpstream(t, "8.8.8.8", 0)
+	handler := buildConfig(t, "forward "+slow+" zone=slow.internal timeout=100ms health_check=0s\n"+
+		"forward "+public+" health_check=0s\n")
+
+	start := time.Now()
+	response := serve(handler, "x.slow.internal", dns.TypeA)
+	if response == nil || response.Header.RCode != dns.RCodeServerFailure {
+		t.Errorf("query to the slow upstream answered with %+v, expected SERVFAIL", response)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("query to the slow upstream took %v, expected the 100ms timeout of its rule", elapsed)
+	}
+
+	// The timeout of one rule does not apply to the others
+	if response := serve(handler, "example.com", dns.TypeA); response == nil || len(response.Answers) != 1 {
+		t.Errorf("query to the default upstream answered with %+v", response)
+	}
+}
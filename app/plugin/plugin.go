@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"sort"
+	"sync"
+)
+
+// Plugin is a single step of the query processing chain.
+// It receives the next handler of the chain and returns a handler wrapping it.
+// The returned handler may answer a query itself, modify the query or the response,
+// or pass the query on to next unchanged.
+type Plugin func(next dns.Handler) dns.Handler
+
+// SetupFunc builds a Plugin from the arguments of its configuration directive.
+// ctx lives as long as the chain the plugin ends up in: background work of the plugin, such as
+// health checks, must stop when it is cancelled. Such work should be started by the returned Plugin
+// rather than by the SetupFunc, since the Plugin only runs once every directive was set up.
+type SetupFunc func(ctx context.Context, args []string) (Plugin, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]SetupFunc)
+)
+
+// Register makes a plugin available to configurations under the given name.
+// It is meant to be called from the init function of the file implementing the plugin
+// and panics if the name is registered twice.
+//
+// Parameters:
+// - name: The name of the directive configuring the plugin, such as "forward".
+// - setup: The function building the plugin from the directive arguments.
+func Register(name string, setup SetupFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("plugin: plugin " + name + " registered twice")
+	}
+	registry[name] = setup
+}
+
+// Names returns the names of all registered plugins in alphabetical order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chain wraps last with the given plugins. The first plugin sees every query first,
+// and a query passed on by the last plugin reaches last.
+//
+// Parameters:
+// - plugins: The plugins in the order they process queries.
+// - last: The handler at the end of the chain.
+//
+// Returns:
+// - The handler of the first plugin.
+func Chain(plugins []Plugin, last dns.Handler) dns.Handler {
+	handler := last
+	for i := len(plugins) - 1; i >= 0; i-- {
+		handler = plugins[i](handler)
+	}
+	return handler
+}
+
+// Build sets up the plugins of the given directives and chains them in order.
+// Queries passed on by the last plugin are answered with REFUSED.
+//
+// Parameters:
+// - ctx: Stops the background work of the plugins when cancelled, usually once the chain is no longer used.
+// - directives: The configured plugins, see ParseConfig.
+//
+// Returns:
+// - The handler of the first plugin.
+// - An error if a directive names an unknown plugin or its setup fails. No background work is started then.
+func Build(ctx context.Context, directives []Directive) (dns.Handler, error) {
+	plugins := make([]Plugin, 0, len(directives))
+
+	for _, directive := range directives {
+		registryMu.RLock()
+		setup, ok := registry[directive.Name]
+		registryMu.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown plugin '%s'", directive.Line, directive.Name)
+		}
+
+		p, err := setup(ctx, directive.Args)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: plugin '%s': %w", directive.Line, directive.Name, err)
+		}
+		plugins = append(plugins, p)
+	}
+
+	return Chain(plugins, dns.RCodeHandler(dns.RCodeRefused)), nil
+}
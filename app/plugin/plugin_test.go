@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"context"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"net"
+	"strings"
+	"testing"
+)
+
+// testWriter is a dns.ResponseWriter remembering the last response written to it.
+type testWriter struct {
+	msg *dns.Message
+}
+
+func (w *testWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+func (w *testWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}
+}
+
+func (w *testWriter) Network() string { return "udp" }
+
+func (w *testWriter) WriteMsg(m *dns.Message) error {
+	w.msg = m
+	return nil
+}
+
+// serve passes a query for name and type to the handler and returns the response it wrote, if any.
+func serve(handler dns.Handler, name string, rrType dns.Type) *dns.Message {
+	w := &testWriter{}
+	handler.ServeDNS(w, &dns.Message{
+		Header:    dns.Header{ID: 99, RD: true, QDCount: 1},
+		Questions: []dns.Question{{Name: name, Type: rrType, Class: dns.ClassIN}},
+	})
+	return w.msg
+}
+
+func TestParseConfig(t *testing.T) {
+	config := `# a comment line
+
+static 10.0.0.1 ::1   # trailing comment
+	forward 8.8.8.8:53 zone=example.com
+`
+	directives, err := ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Directive{
+		{Name: "static", Args: []string{"10.0.0.1", "::1"}, Line: 3},
+		{Name: "forward", Args: []string{"8.8.8.8:53", "zone=example.com"}, Line: 4},
+	}
+	if len(directives) != len(want) {
+		t.Fatalf("got %d directives, expected %d", len(directives), len(want))
+	}
+	for i, directive := range directives {
+		if directive.Name != want[i].Name || directive.Line != want[i].Line || strings.Join(directive.Args, " ") != strings.Join(want[i].Args, " ") {
+			t.Errorf("directive %d is %+v, expected %+v", i, directive, want[i])
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	tag := func(name string) Plugin {
+		return func(next dns.Handler) dns.Handler {
+			return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+				order = append(order, name)
+				next.ServeDNS(w, r)
+			})
+		}
+	}
+	last := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		order = append(order, "last")
+		_ = w.WriteMsg(dns.NewResponse(r))
+	})
+
+	serve(Chain([]Plugin{tag("first"), tag("second")}, last), "example.com", dns.TypeA)
+
+	if strings.Join(order, ",") != "first,second,last" {
+		t.Errorf("handlers ran in order %v, expected first, second, last", order)
+	}
+}
+
+func TestStaticPassesOnOtherTypes(t *testing.T) {
+	static, err := setupStatic(context.Background(), []string{"192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The next handler answers NOTIMP, so a response tells which handler answered
+	handler := Chain([]Plugin{static}, dns.RCodeHandler(dns.RCodeNotImplemented))
+
+	response := serve(handler, "example.com", dns.TypeA)
+	if response == nil || response.Header.RCode != dns.RCodeSuccess || !response.Header.AA || len(response.Answers) != 1 {
+		t.Fatalf("A query answered with %+v, expected the static address", response)
+	}
+	if got := response.Answers[0].RData.String(); got != "192.0.2.1" {
+		t.Errorf("A query answered with %s, expected 192.0.2.1", got)
+	}
+
+	if response := serve(handler, "example.com", dns.TypeTXT); response == nil || response.Header.RCode != dns.RCodeNotImplemented {
+		t.Errorf("TXT query answered with %+v, expected it to reach the next handler", response)
+	}
+}
+
+func TestBuildRefusesAtEndOfChain(t *testing.T) {
+	directives, err := ParseConfig(strings.NewReader("static 192.0.2.1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := Build(context.Background(), directives)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response := serve(handler, "example.com", dns.TypeA); response == nil || len(response.Answers) != 1 {
+		t.Errorf("A query answered with %+v, expected the static address", response)
+	}
+	if response := serve(handler, "example.com", dns.TypeTXT); response == nil || response.Header.RCode != dns.RCodeRefused {
+		t.Errorf("query passed on by every plugin answered with %+v, expected REFUSED", response)
+	}
+
+	empty, err := Build(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := serve(empty, "example.com", dns.TypeA); response == nil || response.Header.RCode != dns.RCodeRefused {
+		t.Errorf("empty chain answered with %+v, expected REFUSED", response)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown plugin":    "static 192.0.2.1\n\nbogus 1\n",
+		"invalid address":   "# comment\n\nstatic not-an-address\n",
+		"missing addresses": "\n\nstatic\n",
+		"missing upstream":  "\n\nforward\n",
+	}
+
+	for description, config := range tests {
+		directives, err := ParseConfig(strings.NewReader(config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Build(context.Background(), directives)
+		if err == nil {
+			t.Errorf("%s: expected an error", description)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "line 3: ") {
+			t.Errorf("%s: error '%v' does not point at line 3", description, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package plugin
+
+import "github.com/codecrafters-io/dns-server-starter-go/app/dns"
+
+// Recorder is a dns.ResponseWriter which passes responses on to the wrapped writer
+// and remembers the last one, so a plugin can inspect the response produced further down the chain.
+type Recorder struct {
+	dns.ResponseWriter
+	Msg *dns.Message
+}
+
+// NewRecorder wraps w in a Recorder.
+func NewRecorder(w dns.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+// WriteMsg remembers the response and writes it to the wrapped writer.
+func (r *Recorder) WriteMsg(m *dns.Message) error {
+	r.Msg = m
+	return r.ResponseWriter.WriteMsg(m)
+}
+
+// discardWriter is a dns.ResponseWriter which drops every response. It keeps the addresses of
+// the wrapped writer, so handlers can resolve a query in the background on behalf of a client.
+type discardWriter struct {
+	dns.ResponseWriter
+}
+
+func (w discardWriter) WriteMsg(*dns.Message) error { return nil }
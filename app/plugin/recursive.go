@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"github.com/codecrafters-io/dns-server-starter-go/app/resolve"
+	"strconv"
+)
+
+func init() {
+	Register("recursive", setupRecursive)
+}
+
+// setupRecursive configures the recursive plugin, which resolves every query iteratively
+// starting at the root servers instead of relying on an upstream resolver:
+//
+//	recursive [ROOT_ADDRESS...] [port=PORT] [max_depth=COUNT] [max_queries=COUNT] [timeout=DURATION]
+//
+// Without root addresses the IANA root servers are used. port is the port of the name servers found
+// in referrals, 53 by default. max_depth limits the nested resolutions of CNAME targets and name servers
+// without glue (8 by default), max_queries the queries sent for a single client query (64 by default)
+// and timeout the wait for a single server (2s by default).
+//
+// The plugin answers every query itself and never calls the next handler.
+func setupRecursive(_ context.Context, args []string) (Plugin, error) {
+	roots, optionArgs := splitArgs(args)
+	options, err := parseOptions(optionArgs, "port", "max_depth", "max_queries", "timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	recursor := &resolve.Recursor{}
+	for _, root := range roots {
+		address, err := resolve.ParseUpstream(root)
+		if err != nil {
+			return nil, err
+		}
+		recursor.Roots = append(recursor.Roots, address)
+	}
+
+	port, err := intOption(options, "port", 53)
+	if err != nil {
+		return nil, err
+	}
+	recursor.Port = strconv.Itoa(port)
+
+	if recursor.MaxDepth, err = intOption(options, "max_depth", recursor.MaxDepth); err != nil {
+		return nil, err
+	}
+	if recursor.MaxQueries, err = intOption(options, "max_queries", recursor.MaxQueries); err != nil {
+		return nil, err
+	}
+	if recursor.Timeout, err = durationOption(options, "timeout", recursor.Timeout); err != nil {
+		return nil, err
+	}
+
+	return func(next dns.Handler) dns.Handler {
+		return recursor
+	}, nil
+}
@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"net"
+)
+
+// staticTTL is the TTL of the answers of the static plugin.
+const staticTTL = 60
+
+func init() {
+	Register("static", setupStatic)
+}
+
+// setupStatic configures the static plugin, which answers address queries for every name with fixed addresses:
+//
+//	static ADDRESS...
+//
+// A queries are answered with the IPv4 addresses and AAAA queries with the IPv6 addresses.
+// Queries of other types, or of a type no address was configured for, are passed on to the next handler.
+func setupStatic(_ context.Context, args []string) (Plugin, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("expected at least one address")
+	}
+
+	addresses := make(map[dns.Type][]dns.RData)
+	for _, arg := range args {
+		ip := net.ParseIP(arg)
+		switch {
+		case ip == nil:
+			return nil, fmt.Errorf("'%s' is not an IP address", arg)
+		case ip.To4() != nil:
+			addresses[dns.TypeA] = append(addresses[dns.TypeA], &dns.A{IP: ip.To4()})
+		default:
+			addresses[dns.TypeAAAA] = append(addresses[dns.TypeAAAA], &dns.AAAA{IP: ip})
+		}
+	}
+
+	return func(next dns.Handler) dns.Handler {
+		return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+			if len(r.Questions) != 1 || r.Questions[0].Class != dns.ClassIN {
+				next.ServeDNS(w, r)
+				return
+			}
+
+			question := r.Questions[0]
+			records := addresses[question.Type]
+			if len(records) == 0 {
+				next.ServeDNS(w, r)
+				return
+			}
+
+			response := dns.NewResponse(r)
+			response.Header.AA = true
+			for _, record := range records {
+				response.Answers = append(response.Answers, dns.Answer{
+					Name:  question.Name,
+					Type:  question.Type,
+					Class: dns.ClassIN,
+					TTL:   staticTTL,
+					RData: record,
+				})
+			}
+
+			if err := w.WriteMsg(response); err != nil {
+				fmt.Println("Failed to send response:", err)
+			}
+		})
+	}, nil
+}
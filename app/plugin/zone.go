@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"github.com/codecrafters-io/dns-server-starter-go/app/zone"
+)
+
+func init() {
+	Register("zone", setupZone)
+}
+
+// setupZone configures the zone plugin, which answers authoritatively for a zone loaded from an RFC 1035 master file:
+//
+//	zone FILE [ORIGIN]
+//
+// ORIGIN qualifies the relative names of the file until it sets $ORIGIN itself. The apex of the zone
+// is the owner of its SOA record. Queries for names outside the zone are passed on to the next handler.
+func setupZone(_ context.Context, args []string) (Plugin, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("expected a zone file and an optional origin, got %d arguments", len(args))
+	}
+
+	origin := ""
+	if len(args) == 2 {
+		origin = args[1]
+	}
+
+	authority, err := zone.Load(args[0], origin)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("Loaded zone", authority.Origin+".", "from", args[0])
+
+	return func(next dns.Handler) dns.Handler {
+		return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+			if len(r.Questions) == 1 && authority.Contains(r.Questions[0].Name) {
+				authority.ServeDNS(w, r)
+				return
+			}
+			next.ServeDNS(w, r)
+		})
+	}, nil
+}
@@ -0,0 +1,40 @@
+package resolve
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// defaultPort is the port of an upstream address given without one.
+const defaultPort = "53"
+
+// ParseUpstream validates the address of an upstream server and adds the default port 53 if it is missing.
+// IPv4 and IPv6 addresses are accepted with or without a port, for example "8.8.8.8", "8.8.8.8:53",
+// "::1", "[::1]" and "[::1]:5353", as well as host names such as "dns.example.com:53".
+//
+// Parameters:
+// - address: The address as configured by the user.
+//
+// Returns:
+// - The address in host:port form, ready to be dialed.
+// - An error if the address cannot be parsed.
+func ParseUpstream(address string) (string, error) {
+	if address == "" {
+		return "", fmt.Errorf("empty upstream address")
+	}
+
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		if host == "" || port == "" {
+			return "", fmt.Errorf("invalid upstream address '%s'", address)
+		}
+		return address, nil
+	}
+
+	// Without a port, IPv6 addresses may still be wrapped in brackets
+	host := strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid upstream address '%s'", address)
+	}
+	return net.JoinHostPort(host, defaultPort), nil
+}
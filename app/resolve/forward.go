@@ -0,0 +1,310 @@
+package resolve
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultTimeout is how long the Forwarder waits for an upstream response.
+const defaultTimeout = 5 * time.Second
+
+// ErrMismatchedResponse is returned when an upstream answers over TCP or QUIC with a response
+// that does not belong to the query that was sent.
+var ErrMismatchedResponse = errors.New("upstream response does not match the query")
+
+// Forwarder relays queries to an upstream DNS server and returns its responses unchanged:
+// every section, every record type, the original TTLs and the upstream RCode are passed back to the client.
+// The only exception is the OPT record, since EDNS is negotiated hop by hop (RFC 6891 section 6.1.1):
+// the upstream gets our own payload size and never sees the options of the client, and the client
+// gets our OPT record instead of the one of the upstream, whose cookie and NSID belong to that server.
+//
+// Fields:
+//
+// - Address: The address of the upstream server, such as "8.8.8.8:53".
+//
+// - Timeout: How long to wait for the upstream response. Defaults to 5 seconds.
+//
+// - QUIC: Dials DNS-over-QUIC connections (RFC 9250). If set, queries are sent over QUIC to Address,
+// usually on port 853, instead of over UDP and TCP.
+//
+// - TLSConfig: The TLS configuration of QUIC connections, prepared with dns.QUICTLSConfig.
+// Without a ServerName the host of Address is verified.
+type Forwarder struct {
+	Address   string
+	Timeout   time.Duration
+	QUIC      dns.QUICDialer
+	TLSConfig *tls.Config
+
+	mu       sync.Mutex
+	quicConn dns.QUICConn
+}
+
+// NewForwarder creates a Forwarder relaying queries to the given upstream address.
+//
+// Parameters:
+// - address: The address of the upstream DNS server.
+//
+// Returns:
+// - A pointer to the Forwarder.
+func NewForwarder(address string) *Forwarder {
+	return &Forwarder{Address: address}
+}
+
+// Exchange sends the query to the upstream server and waits for its response.
+// The query is sent over UDP with a fresh random ID; responses whose ID or question do not match
+// are ignored. A truncated UDP response is retried over TCP. Over QUIC the query gets its own stream
+// of a connection shared by every exchange and the ID 0 DoQ requires. The returned response carries the ID
+// of the original query, and an OPT record built like NewResponse does if the query used EDNS.
+//
+// Parameters:
+// - ctx: Cancels the exchange. Its deadline, if earlier than Timeout, limits the exchange.
+// - query: The query to forward.
+//
+// Returns:
+// - A pointer to the upstream response.
+// - An error if the upstream cannot be reached or does not answer in time.
+func (f *Forwarder) Exchange(ctx context.Context, query *dns.Message) (*dns.Message, error) {
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	upstreamQuery := *query
+	upstreamQuery.Header.ID = uint16(rand.Uint32())
+	if edns := query.EDNS(); edns != nil {
+		upstreamQuery.SetEDNS(&dns.EDNS{UDPSize: dns.DefaultEDNSUDPSize, DO: edns.DO})
+	}
+
+	if f.QUIC != nil {
+		upstreamQuery.Header.ID = 0
+	}
+
+	packet, err := upstreamQuery.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var response *dns.Message
+	if f.QUIC != nil {
+		response, err = f.exchangeQUIC(ctx, packet, &upstreamQuery)
+	} else {
+		response, err = f.exchangeUDP(ctx, packet, &upstreamQuery)
+		if err == nil && response.Header.TC {
+			response, err = f.exchangeTCP(ctx, packet, &upstreamQuery)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response.Header.ID = query.Header.ID
+
+	// Keep the extended RCODE of the upstream while replacing its OPT record with ours
+	rcode := response.RCode()
+	response.SetEDNS(dns.NewResponse(query).EDNS())
+	response.SetRCode(rcode)
+	return response, nil
+}
+
+// exchangeUDP sends the packet over UDP and reads until a response matching the query arrives.
+func (f *Forwarder) exchangeUDP(ctx context.Context, packet []byte, query *dns.Message) (*dns.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", f.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn(conn)
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0xFFFF)
+	for {
+		size, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := dns.UnMarshallMessage(buf[:size])
+		if err != nil || !isResponseTo(response, query) {
+			// Not our response, possibly a late answer to an earlier query or a spoofing attempt
+			continue
+		}
+		return response, nil
+	}
+}
+
+// exchangeTCP sends the packet over a new TCP connection and reads the response.
+func (f *Forwarder) exchangeTCP(ctx context.Context, packet []byte, query *dns.Message) (*dns.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", f.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn(conn)
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := dns.WriteTCPMessage(conn, packet); err != nil {
+		return nil, err
+	}
+
+	encoded, err := dns.ReadTCPMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := dns.UnMarshallMessage(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if !isResponseTo(response, query) {
+		return nil, ErrMismatchedResponse
+	}
+	return response, nil
+}
+
+// exchangeQUIC sends the packet on a new stream of the QUIC connection to the upstream and reads the response.
+// The connection is dropped after a failure that is not a timeout of this exchange, so the next exchange
+// dials a new one; a response with an ID other than 0 is a protocol error (RFC 9250 section 4.3.3).
+func (f *Forwarder) exchangeQUIC(ctx context.Context, packet []byte, query *dns.Message) (*dns.Message, error) {
+	conn, err := f.quicConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := conn.OpenStream(ctx)
+	if err != nil && ctx.Err() == nil {
+		// The upstream may have closed the connection while it was idle, so give a new one a try
+		f.dropQUICConnection(conn, dns.DoQNoError)
+		if conn, err = f.quicConnection(ctx); err != nil {
+			return nil, err
+		}
+		stream, err = conn.OpenStream(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := exchangeStream(ctx, stream, packet)
+	if err != nil {
+		if ctx.Err() == nil {
+			f.dropQUICConnection(conn, dns.DoQNoError)
+		}
+		return nil, err
+	}
+	if !isResponseTo(response, query) {
+		f.dropQUICConnection(conn, dns.DoQProtocolError)
+		return nil, ErrMismatchedResponse
+	}
+	return response, nil
+}
+
+// exchangeStream sends the packet on the stream, ends the stream and reads the response.
+func exchangeStream(ctx context.Context, stream dns.QUICStream, packet []byte) (*dns.Message, error) {
+	stop := context.AfterFunc(ctx, func() { _ = stream.SetDeadline(time.Now()) })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	if err := dns.WriteTCPMessage(stream, packet); err != nil {
+		return nil, err
+	}
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+
+	encoded, err := dns.ReadTCPMessage(stream)
+	if err != nil {
+		return nil, err
+	}
+	return dns.UnMarshallMessage(encoded)
+}
+
+// quicConnection returns the QUIC connection to the upstream, dialing it if there is none.
+func (f *Forwarder) quicConnection(ctx context.Context) (dns.QUICConn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.quicConn != nil {
+		return f.quicConn, nil
+	}
+
+	config := dns.QUICTLSConfig(f.TLSConfig)
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(f.Address)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+
+	conn, err := f.QUIC.DialQUIC(ctx, f.Address, config)
+	if err != nil {
+		return nil, err
+	}
+	f.quicConn = conn
+	return conn, nil
+}
+
+// dropQUICConnection closes the connection with the given DoQ error code, unless another exchange already replaced it.
+func (f *Forwarder) dropQUICConnection(conn dns.QUICConn, code uint64) {
+	f.mu.Lock()
+	if f.quicConn == conn {
+		f.quicConn = nil
+	}
+	f.mu.Unlock()
+
+	if err := conn.CloseWithError(code, ""); err != nil {
+		fmt.Println("Failed to close upstream QUIC connection:", err)
+	}
+}
+
+// isResponseTo reports whether response answers query: it must be a response with the same ID
+// and the same questions, compared case-insensitively. Error responses may leave out the questions.
+func isResponseTo(response, query *dns.Message) bool {
+	if !response.Header.QR || response.Header.ID != query.Header.ID {
+		return false
+	}
+	if len(response.Questions) == 0 && response.Header.RCode != dns.RCodeSuccess {
+		return true
+	}
+	if len(response.Questions) != len(query.Questions) {
+		return false
+	}
+
+	for i, question := range query.Questions {
+		answered := response.Questions[i]
+		if answered.Type != question.Type || answered.Class != question.Class ||
+			dns.CanonicalName(answered.Name) != dns.CanonicalName(question.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+func closeConn(conn net.Conn) {
+	if err := conn.Close(); err != nil {
+		fmt.Println("Failed to close upstream connection:", err)
+	}
+}
@@ -0,0 +1,278 @@
+package resolve
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startUpstream serves the handler over UDP and TCP on a free loopback port and returns its address.
+func startUpstream(t *testing.T, handler dns.Handler) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		_ = listener.Close()
+		t.Fatal(err)
+	}
+
+	server := &dns.Server{Handler: handler}
+	go server.ServeUDP(conn)
+	go server.ServeTCP(listener)
+	t.Cleanup(server.Shutdown)
+	return listener.Addr().String()
+}
+
+// newQuery builds a recursive query for name and rrType.
+func newQuery(name string, rrType dns.Type) *dns.Message {
+	return &dns.Message{
+		Header:    dns.Header{ID: 4242, RD: true, QDCount: 1},
+		Questions: []dns.Question{{Name: name, Type: rrType, Class: dns.ClassIN}},
+	}
+}
+
+func TestForwarderEDNSIsHopByHop(t *testing.T) {
+	upstreamQueries := make(chan *dns.Message, 1)
+	address := startUpstream(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		upstreamQueries <- r
+
+		response := dns.NewResponse(r)
+		response.SetEDNS(&dns.EDNS{
+			UDPSize: 1232,
+			DO:      true,
+			Options: []dns.EDNSOption{&dns.NSIDOption{ID: []byte("upstream")}},
+		})
+		response.SetRCode(dns.RCodeBadVers)
+		_ = w.WriteMsg(response)
+	}))
+
+	query := newQuery("example.com", dns.TypeA)
+	query.SetEDNS(&dns.EDNS{UDPSize: 4096, Options: []dns.EDNSOption{&dns.NSIDOption{}}})
+
+	response, err := NewForwarder(address).Exchange(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstreamEDNS := (<-upstreamQueries).EDNS()
+	if upstreamEDNS == nil || upstreamEDNS.UDPSize != dns.DefaultEDNSUDPSize || len(upstreamEDNS.Options) != 0 {
+		t.Errorf("upstream got EDNS %+v, expected our payload size without the client options", upstreamEDNS)
+	}
+
+	edns := response.EDNS()
+	if edns == nil || edns.UDPSize != dns.DefaultEDNSUDPSize || edns.DO || len(edns.Options) != 0 {
+		t.Errorf("client got EDNS %+v, expected our own OPT record", edns)
+	}
+	if rcode := response.RCode(); rcode != dns.RCodeBadVers {
+		t.Errorf("got rcode %d, expected the extended rcode %d of the upstream", rcode, dns.RCodeBadVers)
+	}
+	if response.Header.ID != query.Header.ID {
+		t.Errorf("got ID %d, expected %d", response.Header.ID, query.Header.ID)
+	}
+}
+
+func TestForwarderStripsEDNSForPlainQueries(t *testing.T) {
+	address := startUpstream(t, dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		response := dns.NewResponse(r)
+		response.SetEDNS(&dns.EDNS{UDPSize: 1232})
+		_ = w.WriteMsg(response)
+	}))
+
+	response, err := NewForwarder(address).Exchange(context.Background(), newQuery("example.com", dns.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edns := response.EDNS(); edns != nil {
+		t.Errorf("client without EDNS got EDNS %+v", edns)
+	}
+}
+
+// quicPipe is one end of an in-memory QUIC connection. Closing either end closes both and every stream;
+// streams end only their writing direction on Close.
+type quicPipe struct {
+	accept chan dns.QUICStream
+	open   chan dns.QUICStream
+	closed chan struct{}
+	once   *sync.Once
+	mu     *sync.Mutex
+	pipes  *[]*io.PipeReader
+}
+
+type quicPipeStream struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func (s *quicPipeStream) Read(p []byte) (int, error)  { return s.r.Read(p) }
+func (s *quicPipeStream) Write(p []byte) (int, error) { return s.w.Write(p) }
+func (s *quicPipeStream) Close() error                { return s.w.Close() }
+func (s *quicPipeStream) SetDeadline(time.Time) error { return nil }
+
+func (c *quicPipe) AcceptStream(ctx context.Context) (dns.QUICStream, error) {
+	select {
+	case stream := <-c.accept:
+		return stream, nil
+	case <-c.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *quicPipe) OpenStream(ctx context.Context) (dns.QUICStream, error) {
+	inRead, inWrite := io.Pipe()
+	outRead, outWrite := io.Pipe()
+	c.mu.Lock()
+	*c.pipes = append(*c.pipes, inRead, outRead)
+	c.mu.Unlock()
+
+	select {
+	case c.open <- &quicPipeStream{r: outRead, w: inWrite}:
+		return &quicPipeStream{r: inRead, w: outWrite}, nil
+	case <-c.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *quicPipe) LocalAddr() net.Addr  { return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 853} }
+func (c *quicPipe) RemoteAddr() net.Addr { return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4321} }
+
+func (c *quicPipe) CloseWithError(code uint64, reason string) error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, pipe := range *c.pipes {
+			_ = pipe.CloseWithError(net.ErrClosed)
+		}
+	})
+	return nil
+}
+
+// quicUpstream is an in-memory DNS-over-QUIC server, which is also the dns.QUICDialer connecting to it.
+type quicUpstream struct {
+	conns   chan dns.QUICConn
+	closed  chan struct{}
+	dials   atomic.Int32
+	configs chan *tls.Config
+}
+
+func (u *quicUpstream) Accept(ctx context.Context) (dns.QUICConn, error) {
+	select {
+	case conn := <-u.conns:
+		return conn, nil
+	case <-u.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (u *quicUpstream) Addr() net.Addr { return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 853} }
+
+func (u *quicUpstream) Close() error {
+	close(u.closed)
+	return nil
+}
+
+func (u *quicUpstream) DialQUIC(ctx context.Context, address string, config *tls.Config) (dns.QUICConn, error) {
+	u.dials.Add(1)
+	select {
+	case u.configs <- config:
+	default:
+	}
+
+	var pipes []*io.PipeReader
+	toServer, toClient, closed := make(chan dns.QUICStream), make(chan dns.QUICStream), make(chan struct{})
+	once, mu := &sync.Once{}, &sync.Mutex{}
+	client := &quicPipe{accept: toClient, open: toServer, closed: closed, once: once, mu: mu, pipes: &pipes}
+	server := &quicPipe{accept: toServer, open: toClient, closed: closed, once: once, mu: mu, pipes: &pipes}
+
+	select {
+	case u.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startQUICUpstream serves the handler over in-memory DNS-over-QUIC connections.
+func startQUICUpstream(t *testing.T, server *dns.Server) *quicUpstream {
+	t.Helper()
+
+	upstream := &quicUpstream{conns: make(chan dns.QUICConn), closed: make(chan struct{}), configs: make(chan *tls.Config, 1)}
+	go server.ServeQUIC(upstream)
+	t.Cleanup(server.Shutdown)
+	return upstream
+}
+
+func TestForwarderOverQUIC(t *testing.T) {
+	upstreamIDs := make(chan uint16, 2)
+	upstream := startQUICUpstream(t, &dns.Server{Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+		upstreamIDs <- r.Header.ID
+		response := dns.NewResponse(r)
+		response.Answers = []dns.Answer{{
+			Name: r.Questions[0].Name, Type: dns.TypeA, Class: dns.ClassIN, TTL: 60,
+			RData: &dns.A{IP: net.IPv4(192, 0, 2, 1).To4()},
+		}}
+		_ = w.WriteMsg(response)
+	})})
+	forwarder := &Forwarder{Address: "dns.example:853", QUIC: upstream}
+
+	for i := 0; i < 2; i++ {
+		response, err := forwarder.Exchange(context.Background(), newQuery("example.com", dns.TypeA))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Header.ID != 4242 || len(response.Answers) != 1 {
+			t.Errorf("got response %+v, expected the answer with the ID of the query", response)
+		}
+		if id := <-upstreamIDs; id != 0 {
+			t.Errorf("upstream got message ID %d, expected 0", id)
+		}
+	}
+
+	if dials := upstream.dials.Load(); dials != 1 {
+		t.Errorf("dialed %d connections, expected both queries to share one", dials)
+	}
+	config := <-upstream.configs
+	if config.ServerName != "dns.example" || len(config.NextProtos) != 1 || config.NextProtos[0] != dns.DoQALPN {
+		t.Errorf("dialed with server name '%s' and protocols %v, expected dns.example and doq", config.ServerName, config.NextProtos)
+	}
+}
+
+func TestForwarderQUICRedialsClosedConnections(t *testing.T) {
+	upstream := startQUICUpstream(t, &dns.Server{
+		IdleTimeout: 20 * time.Millisecond,
+		Handler:     dns.RCodeHandler(dns.RCodeNameError),
+	})
+	forwarder := &Forwarder{Address: "127.0.0.1:853", QUIC: upstream}
+
+	for i := 0; i < 2; i++ {
+		response, err := forwarder.Exchange(context.Background(), newQuery("example.com", dns.TypeA))
+		if err != nil {
+			t.Fatalf("exchange %d failed: %v", i, err)
+		}
+		if response.Header.RCode != dns.RCodeNameError {
+			t.Errorf("got rcode %d, expected NXDOMAIN", response.Header.RCode)
+		}
+		// Long enough for the upstream to close the idle connection
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if dials := upstream.dials.Load(); dials != 2 {
+		t.Errorf("dialed %d connections, expected a new one after the upstream closed the first", dials)
+	}
+}
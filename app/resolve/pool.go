@@ -0,0 +1,305 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultMaxFails is how many consecutive failures eject an upstream.
+	defaultMaxFails = 2
+
+	// defaultEjectTimeout is how long an ejected upstream is skipped before it is tried again.
+	defaultEjectTimeout = 30 * time.Second
+)
+
+// Policy decides in which order a Pool tries its upstreams.
+type Policy int
+
+const (
+	// PolicyRoundRobin starts every query at the next upstream in turn.
+	PolicyRoundRobin Policy = iota
+
+	// PolicyRandom tries the upstreams in a random order.
+	PolicyRandom
+
+	// PolicyLowestLatency tries the upstream with the lowest average response time first.
+	PolicyLowestLatency
+
+	// PolicyStrictOrder always tries the upstreams in the configured order, falling back to the next one on failure.
+	PolicyStrictOrder
+)
+
+var policyNames = map[Policy]string{
+	PolicyRoundRobin:    "round_robin",
+	PolicyRandom:        "random",
+	PolicyLowestLatency: "lowest_latency",
+	PolicyStrictOrder:   "strict_order",
+}
+
+func (p Policy) String() string {
+	if name, ok := policyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// ParsePolicy returns the policy with the given name, such as "round_robin" or "strict_order".
+//
+// Parameters:
+// - name: The name of the policy.
+//
+// Returns:
+// - The Policy.
+// - An error if no policy has that name.
+func ParsePolicy(name string) (Policy, error) {
+	for policy, policyName := range policyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+
+	names := make([]string, 0, len(policyNames))
+	for policy := PolicyRoundRobin; policy <= PolicyStrictOrder; policy++ {
+		names = append(names, policy.String())
+	}
+	return 0, fmt.Errorf("unknown policy '%s', expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Upstream is an upstream server of a Pool together with its health.
+// An upstream failing MaxFails times in a row is ejected: the pool only tries it after every
+// healthy upstream failed, until EjectTimeout passed. It is then tried again like the others,
+// and a single further failure ejects it again. Any successful exchange makes it healthy.
+type Upstream struct {
+	*Forwarder
+
+	mu           sync.Mutex
+	fails        int
+	ejectedUntil time.Time
+	latency      time.Duration
+}
+
+// Healthy reports whether the upstream is currently not ejected.
+func (u *Upstream) Healthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return time.Now().After(u.ejectedUntil)
+}
+
+// Latency returns the moving average of the response times of the upstream, or 0 before its first response.
+func (u *Upstream) Latency() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.latency
+}
+
+// Pool forwards queries to a list of upstream servers, choosing the upstream with its Policy
+// and moving on to the next one when an upstream cannot be reached.
+//
+// Upstreams are checked passively, by counting the failed exchanges of real queries, and actively
+// by HealthCheck. Unhealthy upstreams are ejected, see Upstream.
+//
+// Fields:
+//
+// - Upstreams: The upstream servers.
+//
+// - Policy: The order in which the upstreams are tried.
+//
+// - MaxFails: How many consecutive failures eject an upstream. Defaults to 2.
+//
+// - EjectTimeout: How long an ejected upstream is skipped. Defaults to 30 seconds.
+type Pool struct {
+	Upstreams    []*Upstream
+	Policy       Policy
+	MaxFails     int
+	EjectTimeout time.Duration
+
+	next atomic.Uint64
+}
+
+// NewPool creates a Pool forwarding to the given upstream addresses with the round-robin policy.
+//
+// Parameters:
+// - addresses: The addresses of the upstream servers, see ParseUpstream.
+//
+// Returns:
+// - A pointer to the Pool.
+func NewPool(addresses []string) *Pool {
+	upstreams := make([]*Upstream, len(addresses))
+	for i, address := range addresses {
+		upstreams[i] = &Upstream{Forwarder: NewForwarder(address)}
+	}
+	return &Pool{Upstreams: upstreams, Policy: PolicyRoundRobin}
+}
+
+// ServeDNS forwards the query and writes the upstream response to the client.
+// If no upstream can be reached the client gets a SERVFAIL response.
+func (p *Pool) ServeDNS(w dns.ResponseWriter, r *dns.Message) {
+	response, err := p.Exchange(context.Background(), r)
+	if err != nil {
+		fmt.Println("Failed to forward query:", err)
+		dns.RCodeHandler(dns.RCodeServerFailure).ServeDNS(w, r)
+		return
+	}
+
+	if err := w.WriteMsg(response); err != nil {
+		fmt.Println("Failed to send response:", err)
+	}
+}
+
+// Exchange sends the query to the upstreams in the order chosen by the policy
+// until one of them responds. Every upstream is given its own Timeout.
+//
+// Parameters:
+// - ctx: Cancels the exchange.
+// - query: The query to forward.
+//
+// Returns:
+// - A pointer to the first upstream response.
+// - An error joining the errors of every upstream if none of them responded.
+func (p *Pool) Exchange(ctx context.Context, query *dns.Message) (*dns.Message, error) {
+	var errs []error
+	for _, upstream := range p.order() {
+		start := time.Now()
+		response, err := upstream.Exchange(ctx, query)
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about the upstream
+			return nil, ctx.Err()
+		}
+
+		p.record(upstream, err, time.Since(start))
+		if err == nil {
+			return response, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", upstream.Address, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no upstream configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// HealthCheck actively probes every upstream each interval until ctx is cancelled.
+// A probe asks for the NS records of the root zone; any response counts as healthy.
+// It blocks, so it is usually run on its own goroutine.
+//
+// Parameters:
+// - ctx: Stops the health checks.
+// - interval: The time between two rounds of probes.
+func (p *Pool) HealthCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var wg sync.WaitGroup
+		for _, upstream := range p.Upstreams {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.probe(ctx, upstream)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// probe sends a health check query to the upstream and records the outcome.
+func (p *Pool) probe(ctx context.Context, upstream *Upstream) {
+	query := &dns.Message{
+		Questions: []dns.Question{{Name: "", Type: dns.TypeNS, Class: dns.ClassIN}},
+	}
+
+	start := time.Now()
+	_, err := upstream.Exchange(ctx, query)
+	if ctx.Err() != nil {
+		return
+	}
+	p.record(upstream, err, time.Since(start))
+}
+
+// order returns the upstreams in the order they should be tried:
+// the healthy ones as chosen by the policy, followed by the ejected ones as a last resort.
+func (p *Pool) order() []*Upstream {
+	healthy := make([]*Upstream, 0, len(p.Upstreams))
+	var ejected []*Upstream
+	for _, upstream := range p.Upstreams {
+		if upstream.Healthy() {
+			healthy = append(healthy, upstream)
+		} else {
+			ejected = append(ejected, upstream)
+		}
+	}
+
+	switch p.Policy {
+	case PolicyRoundRobin:
+		if len(healthy) > 1 {
+			start := int(p.next.Add(1)-1) % len(healthy)
+			healthy = append(healthy[start:], healthy[:start]...)
+		}
+	case PolicyRandom:
+		rand.Shuffle(len(healthy), func(i, j int) { healthy[i], healthy[j] = healthy[j], healthy[i] })
+	case PolicyLowestLatency:
+		// Upstreams without a measurement sort first, so every upstream gets measured
+		latencies := make(map[*Upstream]time.Duration, len(healthy))
+		for _, upstream := range healthy {
+			latencies[upstream] = upstream.Latency()
+		}
+		sort.SliceStable(healthy, func(i, j int) bool { return latencies[healthy[i]] < latencies[healthy[j]] })
+	case PolicyStrictOrder:
+	}
+
+	return slices.Concat(healthy, ejected)
+}
+
+// record updates the health of the upstream after an exchange which took rtt and failed with err, if not nil.
+func (p *Pool) record(upstream *Upstream, err error, rtt time.Duration) {
+	maxFails := p.MaxFails
+	if maxFails <= 0 {
+		maxFails = defaultMaxFails
+	}
+	ejectTimeout := p.EjectTimeout
+	if ejectTimeout <= 0 {
+		ejectTimeout = defaultEjectTimeout
+	}
+
+	upstream.mu.Lock()
+	defer upstream.mu.Unlock()
+
+	if err != nil {
+		upstream.fails++
+		if upstream.fails >= maxFails && time.Now().After(upstream.ejectedUntil) {
+			upstream.ejectedUntil = time.Now().Add(ejectTimeout)
+			fmt.Println("Ejecting upstream", upstream.Address, "for", ejectTimeout, "after", upstream.fails, "failures")
+		}
+		return
+	}
+
+	if upstream.fails >= maxFails {
+		fmt.Println("Upstream", upstream.Address, "is healthy again")
+	}
+	upstream.fails = 0
+	upstream.ejectedUntil = time.Time{}
+
+	// Exponentially weighted moving average, giving the newest sample a weight of 1/8
+	if upstream.latency == 0 {
+		upstream.latency = rtt
+	} else {
+		upstream.latency += (rtt - upstream.latency) / 8
+	}
+}
@@ -0,0 +1,174 @@
+package resolve
+
+import (
+	"context"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingUpstream is a fake upstream counting the queries it answered, after an optional delay.
+type countingUpstream struct {
+	delay   time.Duration
+	queries atomic.Int32
+}
+
+func (u *countingUpstream) ServeDNS(w dns.ResponseWriter, r *dns.Message) {
+	time.Sleep(u.delay)
+	u.queries.Add(1)
+	_ = w.WriteMsg(dns.NewResponse(r))
+}
+
+// deadAddress returns a loopback address nothing listens on, so queries to it fail right away.
+func deadAddress(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := conn.LocalAddr().String()
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return address
+}
+
+// newTestPool creates a pool forwarding to the given addresses with the policy and short timeouts.
+func newTestPool(addresses []string, policy Policy) *Pool {
+	pool := NewPool(addresses)
+	pool.Policy = policy
+	for _, upstream := range pool.Upstreams {
+		upstream.Timeout = 500 * time.Millisecond
+	}
+	return pool
+}
+
+// exchangeN sends n queries through the pool, failing the test if one of them gets no response.
+func exchangeN(t *testing.T, pool *Pool, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if _, err := pool.Exchange(context.Background(), newQuery("example.com", dns.TypeA)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	upstreams := []*countingUpstream{{}, {}, {}}
+	addresses := make([]string, len(upstreams))
+	for i, upstream := range upstreams {
+		addresses[i] = startUpstream(t, upstream)
+	}
+
+	exchangeN(t, newTestPool(addresses, PolicyRoundRobin), 6)
+
+	for i, upstream := range upstreams {
+		if got := upstream.queries.Load(); got != 2 {
+			t.Errorf("upstream %d answered %d of 6 queries, expected 2", i, got)
+		}
+	}
+}
+
+func TestPoolStrictOrder(t *testing.T) {
+	first, second := &countingUpstream{}, &countingUpstream{}
+	pool := newTestPool([]string{startUpstream(t, first), startUpstream(t, second)}, PolicyStrictOrder)
+
+	exchangeN(t, pool, 5)
+
+	if first.queries.Load() != 5 || second.queries.Load() != 0 {
+		t.Errorf("upstreams answered %d and %d queries, expected all by the first", first.queries.Load(), second.queries.Load())
+	}
+}
+
+func TestPoolRandom(t *testing.T) {
+	first, second := &countingUpstream{}, &countingUpstream{}
+	pool := newTestPool([]string{startUpstream(t, first), startUpstream(t, second)}, PolicyRandom)
+
+	exchangeN(t, pool, 40)
+
+	if first.queries.Load() == 0 || second.queries.Load() == 0 {
+		t.Errorf("upstreams answered %d and %d queries, expected both to get some", first.queries.Load(), second.queries.Load())
+	}
+}
+
+func TestPoolLowestLatency(t *testing.T) {
+	slow, fast := &countingUpstream{delay: 50 * time.Millisecond}, &countingUpstream{}
+	pool := newTestPool([]string{startUpstream(t, slow), startUpstream(t, fast)}, PolicyLowestLatency)
+
+	// Upstreams without a measurement go first, so the first two queries measure both
+	exchangeN(t, pool, 2)
+	exchangeN(t, pool, 5)
+
+	if slow.queries.Load() != 1 || fast.queries.Load() != 6 {
+		t.Errorf("slow and fast upstream answered %d and %d queries, expected 1 and 6", slow.queries.Load(), fast.queries.Load())
+	}
+}
+
+func TestPoolEjectsAndReadmitsUpstream(t *testing.T) {
+	dead := deadAddress(t)
+	live := &countingUpstream{}
+	pool := newTestPool([]string{dead, startUpstream(t, live)}, PolicyStrictOrder)
+	pool.MaxFails = 2
+	pool.EjectTimeout = 200 * time.Millisecond
+
+	// Each query fails over to the live upstream until the dead one is ejected
+	exchangeN(t, pool, 2)
+	if pool.Upstreams[0].Healthy() {
+		t.Fatal("upstream still healthy after 2 failures")
+	}
+	if order := pool.order(); order[0] != pool.Upstreams[1] {
+		t.Errorf("ejected upstream %s is tried first", order[0].Address)
+	}
+
+	// Bring the upstream back on the same address and wait for the ejection to expire
+	conn, err := net.ListenPacket("udp", dead)
+	if err != nil {
+		t.Skip("cannot reuse the address of the dead upstream:", err)
+	}
+	revived := &countingUpstream{}
+	server := &dns.Server{Handler: revived}
+	go server.ServeUDP(conn)
+	t.Cleanup(server.Shutdown)
+	time.Sleep(pool.EjectTimeout)
+
+	if !pool.Upstreams[0].Healthy() {
+		t.Fatal("upstream still ejected after the eject timeout")
+	}
+	exchangeN(t, pool, 1)
+	if revived.queries.Load() != 1 {
+		t.Errorf("readmitted upstream answered %d queries, expected 1", revived.queries.Load())
+	}
+}
+
+func TestPoolHealthCheckEjectsDeadUpstream(t *testing.T) {
+	pool := newTestPool([]string{deadAddress(t), startUpstream(t, &countingUpstream{})}, PolicyRoundRobin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.HealthCheck(ctx, 20*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.Upstreams[0].Healthy() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pool.Upstreams[0].Healthy() {
+		t.Error("health checks did not eject the dead upstream")
+	}
+	if !pool.Upstreams[1].Healthy() || pool.Upstreams[1].Latency() == 0 {
+		t.Error("health checks did not measure the live upstream")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("HealthCheck did not stop after the context was cancelled")
+	}
+}
@@ -0,0 +1,368 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+const (
+	// defaultMaxDepth is how many nested resolutions, for CNAME targets and name server names, a resolution may start.
+	defaultMaxDepth = 8
+
+	// defaultMaxQueries is how many queries a single resolution may send to authoritative servers.
+	defaultMaxQueries = 64
+
+	// defaultServerTimeout is how long the Recursor waits for a single authoritative server.
+	defaultServerTimeout = 2 * time.Second
+)
+
+// RootHints are the IPv4 addresses of the root name servers a through m, as published by IANA.
+var RootHints = []string{
+	"198.41.0.4:53",
+	"170.247.170.2:53",
+	"192.33.4.12:53",
+	"199.7.91.13:53",
+	"192.203.230.10:53",
+	"192.5.5.241:53",
+	"192.112.36.4:53",
+	"198.97.190.53:53",
+	"192.36.148.17:53",
+	"192.58.128.30:53",
+	"193.0.14.129:53",
+	"199.7.83.42:53",
+	"202.12.27.33:53",
+}
+
+var (
+	// ErrMaxDepth is returned when a resolution needs more nested resolutions than allowed.
+	ErrMaxDepth = errors.New("recursion depth limit reached")
+
+	// ErrMaxQueries is returned when a resolution needs more queries than allowed.
+	ErrMaxQueries = errors.New("query limit reached")
+
+	// ErrLameDelegation is returned when a server neither answers nor refers to a closer zone.
+	ErrLameDelegation = errors.New("lame delegation")
+)
+
+// Recursor resolves queries iteratively: starting at the root servers it follows the referrals
+// of each zone down to the servers authoritative for the name. Referrals are followed with
+// their glue records, name servers without glue are resolved on their own, and CNAME chains
+// are followed to their target.
+//
+// Fields:
+//
+// - Roots: The addresses of the root servers. Defaults to RootHints.
+//
+// - Port: The port of the name servers learned from referrals. Defaults to "53".
+//
+// - MaxDepth: How many nested resolutions a resolution may start. Defaults to 8.
+//
+// - MaxQueries: How many queries a resolution may send, including nested resolutions. Defaults to 64.
+//
+// - Timeout: How long to wait for a single server. Defaults to 2 seconds.
+type Recursor struct {
+	Roots      []string
+	Port       string
+	MaxDepth   int
+	MaxQueries int
+	Timeout    time.Duration
+}
+
+// resolution tracks the queries sent on behalf of a single client query.
+type resolution struct {
+	queries int
+}
+
+// ServeDNS resolves the question of the query and writes the answer to the client.
+// If the name cannot be resolved the client gets a SERVFAIL response.
+func (r *Recursor) ServeDNS(w dns.ResponseWriter, query *dns.Message) {
+	if len(query.Questions) != 1 {
+		dns.RCodeHandler(dns.RCodeFormatError).ServeDNS(w, query)
+		return
+	}
+
+	result, err := r.Resolve(context.Background(), query.Questions[0])
+	if err != nil {
+		fmt.Println("Failed to resolve", query.Questions[0].Name, ":", err)
+		dns.RCodeHandler(dns.RCodeServerFailure).ServeDNS(w, query)
+		return
+	}
+
+	response := dns.NewResponse(query)
+	response.Header.RA = true
+	response.Header.RCode = result.Header.RCode
+	response.Answers = result.Answers
+	response.Authority = result.Authority
+
+	if err := w.WriteMsg(response); err != nil {
+		fmt.Println("Failed to send response:", err)
+	}
+}
+
+// Resolve looks up the question starting at the root servers.
+//
+// Parameters:
+// - ctx: Cancels the resolution.
+// - question: The question to resolve.
+//
+// Returns:
+// - A pointer to the final response. Its answers hold the CNAME chain leading to the name,
+// if any, followed by the records of the name. Its RCode and authority section are those of
+// the authoritative server of the last name of the chain.
+// - An error if the name cannot be resolved within the limits.
+func (r *Recursor) Resolve(ctx context.Context, question dns.Question) (*dns.Message, error) {
+	return r.resolve(ctx, &resolution{}, question, 0)
+}
+
+// resolve follows the referrals for the question and then the CNAME chain of the answer.
+func (r *Recursor) resolve(ctx context.Context, state *resolution, question dns.Question, depth int) (*dns.Message, error) {
+	if depth > r.maxDepth() {
+		return nil, ErrMaxDepth
+	}
+
+	response, err := r.lookup(ctx, state, question, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a chain the response is final, including NXDOMAIN and NODATA (the name has no records of the type).
+	// An NXDOMAIN at the end of a chain means its target does not exist.
+	chain, target, complete := followCNAMEs(response.Answers, question)
+	if complete || len(chain) == 0 || response.Header.RCode == dns.RCodeNameError {
+		response.Answers = chain
+		return response, nil
+	}
+
+	// The server only knew part of the chain, the rest lives in another zone
+	next, err := r.resolve(ctx, state, dns.Question{Name: target, Type: question.Type, Class: question.Class}, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	next.Answers = append(chain, next.Answers...)
+	return next, nil
+}
+
+// lookup walks down from the root servers to the servers authoritative for the question and returns their response.
+func (r *Recursor) lookup(ctx context.Context, state *resolution, question dns.Question, depth int) (*dns.Message, error) {
+	servers := r.Roots
+	if len(servers) == 0 {
+		servers = RootHints
+	}
+	zone := ""
+
+	for {
+		response, err := r.queryServers(ctx, state, servers, question)
+		if err != nil {
+			return nil, fmt.Errorf("zone '%s': %w", dns.CanonicalName(zone), err)
+		}
+
+		child, names := referral(response, zone, question.Name)
+		if child == "" {
+			if response.Header.AA || len(response.Answers) > 0 || response.Header.RCode == dns.RCodeNameError {
+				return response, nil
+			}
+			return nil, fmt.Errorf("zone '%s': %w", dns.CanonicalName(zone), ErrLameDelegation)
+		}
+
+		servers = r.glue(response, zone, names)
+		if len(servers) == 0 {
+			servers, err = r.resolveServers(ctx, state, names, depth)
+			if err != nil {
+				return nil, fmt.Errorf("name servers of '%s': %w", dns.CanonicalName(child), err)
+			}
+		}
+		zone = child
+	}
+}
+
+// queryServers asks the servers for the question in a random order until one of them responds.
+// Servers failing or answering with an error other than NXDOMAIN are skipped.
+func (r *Recursor) queryServers(ctx context.Context, state *resolution, servers []string, question dns.Question) (*dns.Message, error) {
+	query := &dns.Message{
+		Questions: []dns.Question{question},
+	}
+
+	var errs []error
+	for _, i := range rand.Perm(len(servers)) {
+		if state.queries >= r.maxQueries() {
+			return nil, ErrMaxQueries
+		}
+		state.queries++
+
+		forwarder := &Forwarder{Address: servers[i], Timeout: r.timeout()}
+		response, err := forwarder.Exchange(ctx, query)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", servers[i], err))
+			continue
+		}
+
+		rcode := response.Header.RCode
+		if rcode != dns.RCodeSuccess && rcode != dns.RCodeNameError {
+			errs = append(errs, fmt.Errorf("%s: rcode %d", servers[i], rcode))
+			continue
+		}
+		return response, nil
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no servers")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// resolveServers resolves the addresses of name servers for which the referral carried no glue.
+// The names are tried one after another until one of them has addresses.
+func (r *Recursor) resolveServers(ctx context.Context, state *resolution, names []string, depth int) ([]string, error) {
+	var errs []error
+	for _, name := range names {
+		response, err := r.resolve(ctx, state, dns.Question{Name: name, Type: dns.TypeA, Class: dns.ClassIN}, depth+1)
+		if errors.Is(err, ErrMaxQueries) || errors.Is(err, ErrMaxDepth) || ctx.Err() != nil {
+			return nil, err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		var servers []string
+		for _, record := range response.Answers {
+			if a, ok := record.RData.(*dns.A); ok {
+				servers = append(servers, net.JoinHostPort(a.IP.String(), r.port()))
+			}
+		}
+		if len(servers) > 0 {
+			return servers, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: no addresses", name))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// glue returns the addresses of the name servers given in the additional section of a referral.
+// Only glue inside the zone of the server that sent the referral is trusted, addresses for other
+// names could poison the resolution. IPv4 addresses come first.
+func (r *Recursor) glue(response *dns.Message, zone string, names []string) []string {
+	isServer := make(map[string]bool, len(names))
+	for _, name := range names {
+		isServer[dns.CanonicalName(name)] = true
+	}
+
+	var ipv4, ipv6 []string
+	for _, record := range response.Additional {
+		if !isServer[dns.CanonicalName(record.Name)] || !dns.IsSubDomain(zone, record.Name) {
+			continue
+		}
+		switch rdata := record.RData.(type) {
+		case *dns.A:
+			ipv4 = append(ipv4, net.JoinHostPort(rdata.IP.String(), r.port()))
+		case *dns.AAAA:
+			ipv6 = append(ipv6, net.JoinHostPort(rdata.IP.String(), r.port()))
+		}
+	}
+	return append(ipv4, ipv6...)
+}
+
+func (r *Recursor) port() string {
+	if r.Port == "" {
+		return defaultPort
+	}
+	return r.Port
+}
+
+func (r *Recursor) maxDepth() int {
+	if r.MaxDepth <= 0 {
+		return defaultMaxDepth
+	}
+	return r.MaxDepth
+}
+
+func (r *Recursor) maxQueries() int {
+	if r.MaxQueries <= 0 {
+		return defaultMaxQueries
+	}
+	return r.MaxQueries
+}
+
+func (r *Recursor) timeout() time.Duration {
+	if r.Timeout <= 0 {
+		return defaultServerTimeout
+	}
+	return r.Timeout
+}
+
+// referral returns the zone a response delegates to and the names of its name servers.
+// A referral carries no answers and NS records for a zone below the zone of the server
+// that contains the name being resolved. Anything else yields an empty zone.
+func referral(response *dns.Message, zone, name string) (string, []string) {
+	if len(response.Answers) > 0 || response.Header.RCode != dns.RCodeSuccess {
+		return "", nil
+	}
+
+	child := ""
+	var names []string
+	for _, record := range response.Authority {
+		ns, ok := record.RData.(*dns.NS)
+		if !ok {
+			continue
+		}
+		owner := dns.CanonicalName(record.Name)
+		if owner == dns.CanonicalName(zone) || !dns.IsSubDomain(zone, owner) || !dns.IsSubDomain(owner, name) {
+			continue
+		}
+		if child != "" && owner != child {
+			continue
+		}
+		child = owner
+		names = append(names, ns.Host)
+	}
+	return child, names
+}
+
+// followCNAMEs follows the CNAME chain starting at the question name through the answers.
+//
+// Returns:
+// - The CNAME records of the chain followed by the records of the last name matching the question type.
+// Unrelated records are left out.
+// - The last name of the chain.
+// - Whether the chain ends at records of the question type, or at a CNAME if CNAME records were asked for.
+func followCNAMEs(answers []dns.Answer, question dns.Question) ([]dns.Answer, string, bool) {
+	var chain []dns.Answer
+	name := question.Name
+	seen := make(map[string]bool)
+
+	for !seen[dns.CanonicalName(name)] {
+		seen[dns.CanonicalName(name)] = true
+
+		var matching []dns.Answer
+		var cname *dns.Answer
+		for i, record := range answers {
+			if dns.CanonicalName(record.Name) != dns.CanonicalName(name) {
+				continue
+			}
+			if record.Type == question.Type || question.Type == dns.TypeANY {
+				matching = append(matching, record)
+			} else if record.Type == dns.TypeCNAME && cname == nil {
+				cname = &answers[i]
+			}
+		}
+
+		if len(matching) > 0 {
+			return append(chain, matching...), name, true
+		}
+		if cname == nil {
+			break
+		}
+
+		chain = append(chain, *cname)
+		name = cname.RData.(*dns.CNAME).Target
+	}
+	return chain, name, false
+}
@@ -0,0 +1,208 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"net"
+	"testing"
+)
+
+// fakeAuthority is a fake authoritative server. Names below a delegation get a referral to the
+// name server of the child zone, with glue if an address is given; other names are answered
+// authoritatively from the records.
+type fakeAuthority struct {
+	records     map[string][]dns.RData
+	delegations map[string]delegation
+}
+
+type delegation struct {
+	host string
+	glue string
+}
+
+func record(name string, rdata dns.RData) dns.Answer {
+	return dns.Answer{Name: name, Type: rdata.Type(), Class: dns.ClassIN, TTL: 60, RData: rdata}
+}
+
+func addressRecord(ip string) dns.RData {
+	return &dns.A{IP: net.ParseIP(ip).To4()}
+}
+
+// writeResponse sends the response with header counts matching its sections.
+func writeResponse(w dns.ResponseWriter, response *dns.Message) {
+	response.Header.ANCount = uint16(len(response.Answers))
+	response.Header.NSCount = uint16(len(response.Authority))
+	response.Header.ARCount = uint16(len(response.Additional))
+	_ = w.WriteMsg(response)
+}
+
+func (a *fakeAuthority) ServeDNS(w dns.ResponseWriter, r *dns.Message) {
+	response := dns.NewResponse(r)
+	question := r.Questions[0]
+	name := dns.CanonicalName(question.Name)
+
+	for child, cut := range a.delegations {
+		if dns.IsSubDomain(child, name) {
+			response.Authority = []dns.Answer{record(child, &dns.NS{Host: cut.host})}
+			if cut.glue != "" {
+				response.Additional = []dns.Answer{record(cut.host, addressRecord(cut.glue))}
+			}
+			writeResponse(w, response)
+			return
+		}
+	}
+
+	response.Header.AA = true
+	rdatas, ok := a.records[name]
+	if !ok {
+		response.Header.RCode = dns.RCodeNameError
+	}
+	for _, rdata := range rdatas {
+		if rdata.Type() == question.Type || rdata.Type() == dns.TypeCNAME {
+			response.Answers = append(response.Answers, record(name, rdata))
+		}
+	}
+	writeResponse(w, response)
+}
+
+// startHierarchy serves a small DNS tree on loopback addresses sharing one port:
+//
+//   - 127.0.0.10, the root: delegates test to ns1.test with glue, and org to ns.other.test without glue.
+//   - 127.0.0.11, test: delegates sub.test with glue, and poisoned.test to ns.x.org with
+//     glue pointing at 127.0.0.14, which must be ignored since ns.x.org is outside test.
+//   - 127.0.0.12, org: serves x.org, including ns.x.org at 127.0.0.13.
+//   - 127.0.0.13, sub.test and poisoned.test.
+//   - 127.0.0.14, a poisoned server answering every name with 6.6.6.6.
+//
+// It returns a Recursor using the root.
+func startHierarchy(t *testing.T) *Recursor {
+	t.Helper()
+
+	servers := []struct {
+		ip      string
+		handler dns.Handler
+	}{
+		{"127.0.0.10", &fakeAuthority{delegations: map[string]delegation{
+			"test": {"ns1.test", "127.0.0.11"},
+			"org":  {"ns.other.test", ""},
+		}}},
+		{"127.0.0.11", &fakeAuthority{
+			delegations: map[string]delegation{
+				"sub.test":      {"ns.sub.test", "127.0.0.13"},
+				"poisoned.test": {"ns.x.org", "127.0.0.14"},
+			},
+			records: map[string][]dns.RData{
+				"a.test":        {addressRecord("1.1.1.1")},
+				"ns.other.test": {addressRecord("127.0.0.12")},
+				"alias.test":    {&dns.CNAME{Target: "www.x.org"}},
+				"loop.test":     {&dns.CNAME{Target: "loop2.test"}},
+				"loop2.test":    {&dns.CNAME{Target: "loop.test"}},
+			},
+		}},
+		{"127.0.0.12", &fakeAuthority{records: map[string][]dns.RData{
+			"www.x.org": {addressRecord("2.2.2.2")},
+			"ns.x.org":  {addressRecord("127.0.0.13")},
+		}}},
+		{"127.0.0.13", &fakeAuthority{records: map[string][]dns.RData{
+			"host.sub.test":      {addressRecord("3.3.3.3")},
+			"host.poisoned.test": {addressRecord("4.4.4.4")},
+		}}},
+		{"127.0.0.14", dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Message) {
+			response := dns.NewResponse(r)
+			response.Header.AA = true
+			response.Answers = []dns.Answer{record(r.Questions[0].Name, addressRecord("6.6.6.6"))}
+			writeResponse(w, response)
+		})},
+	}
+
+	port := "0"
+	for _, server := range servers {
+		conn, err := net.ListenPacket("udp", net.JoinHostPort(server.ip, port))
+		if err != nil {
+			t.Skip("cannot listen on the loopback addresses of the hierarchy:", err)
+		}
+		_, port, _ = net.SplitHostPort(conn.LocalAddr().String())
+
+		dnsServer := &dns.Server{Handler: server.handler}
+		go dnsServer.ServeUDP(conn)
+		t.Cleanup(dnsServer.Shutdown)
+	}
+
+	return &Recursor{Roots: []string{net.JoinHostPort("127.0.0.10", port)}, Port: port}
+}
+
+// resolveA resolves the A records of name and returns the addresses of the answer, CNAME targets included.
+func resolveA(t *testing.T, recursor *Recursor, name string) (*dns.Message, []string, error) {
+	t.Helper()
+
+	response, err := recursor.Resolve(context.Background(), dns.Question{Name: name, Type: dns.TypeA, Class: dns.ClassIN})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var data []string
+	for _, answer := range response.Answers {
+		data = append(data, answer.RData.String())
+	}
+	return response, data, nil
+}
+
+func TestRecursorResolves(t *testing.T) {
+	recursor := startHierarchy(t)
+
+	tests := []struct {
+		description string
+		name        string
+		want        []string
+	}{
+		{"referral with glue", "a.test", []string{"1.1.1.1"}},
+		{"two referrals with glue", "host.sub.test", []string{"3.3.3.3"}},
+		{"name server without glue", "www.x.org", []string{"2.2.2.2"}},
+		{"out of bailiwick glue", "host.poisoned.test", []string{"4.4.4.4"}},
+		{"cross zone CNAME chain", "alias.test", []string{"www.x.org", "2.2.2.2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, data, err := resolveA(t, recursor, test.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != len(test.want) {
+				t.Fatalf("got answers %v, expected %v", data, test.want)
+			}
+			for i := range data {
+				if dns.CanonicalName(data[i]) != dns.CanonicalName(test.want[i]) {
+					t.Fatalf("got answers %v, expected %v", data, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecursorNameError(t *testing.T) {
+	response, data, err := resolveA(t, startHierarchy(t), "missing.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Header.RCode != dns.RCodeNameError || len(data) != 0 {
+		t.Errorf("got rcode %d with answers %v, expected NXDOMAIN", response.Header.RCode, data)
+	}
+}
+
+func TestRecursorMaxDepth(t *testing.T) {
+	if _, _, err := resolveA(t, startHierarchy(t), "loop.test"); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("got error %v for a CNAME loop across queries, expected ErrMaxDepth", err)
+	}
+}
+
+func TestRecursorMaxQueries(t *testing.T) {
+	recursor := startHierarchy(t)
+	recursor.MaxQueries = 2
+
+	// The root, test and sub.test servers are needed, one query more than allowed
+	if _, _, err := resolveA(t, recursor, "host.sub.test"); !errors.Is(err, ErrMaxQueries) {
+		t.Errorf("got error %v, expected ErrMaxQueries", err)
+	}
+}
@@ -0,0 +1,374 @@
+package zone
+
+import (
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxIncludeDepth limits nested $INCLUDE directives, which also stops files from including themselves.
+const maxIncludeDepth = 8
+
+// token is a field of a zone file entry. Escapes are kept in place, quoted or not, and decoded
+// once the meaning of the field is known: names by dns.QualifyName, character strings by dns.Unescape.
+type token struct {
+	text   string
+	quoted bool
+}
+
+// entry is a logical line of a zone file: a record or a directive, possibly continued over
+// several lines with parentheses. Entries starting with whitespace reuse the previous owner.
+type entry struct {
+	tokens     []token
+	blankOwner bool
+	line       int
+}
+
+// parser holds the state carried from one entry to the next.
+type parser struct {
+	filename   string
+	origin     string
+	defaultTTL uint32
+	lastTTL    uint32
+	hasTTL     bool
+	lastOwner  string
+	hasOwner   bool
+	records    []dns.Answer
+}
+
+// Parse reads the resource records of a master file as described in RFC 1035 section 5.
+// It supports the $ORIGIN, $TTL (RFC 2308) and $INCLUDE directives, relative names and "@",
+// entries continued over several lines with parentheses, comments starting with ';', quoted
+// character strings, the escapes `\DDD` and `\X`, TTLs with units such as "1h30m" and the record
+// types understood by dns.ParseRData.
+//
+// Records without a TTL use the $TTL value, or else the TTL of the previous record.
+//
+// Parameters:
+// - r: The master file to read.
+// - filename: The name of the file, used in errors and to resolve relative $INCLUDE paths.
+// - origin: The initial origin relative names are qualified with, "" for the root.
+//
+// Returns:
+// - The records in the order they appear.
+// - An error pointing at the line that could not be parsed.
+func Parse(r io.Reader, filename, origin string) ([]dns.Answer, error) {
+	p := &parser{filename: filename, origin: dns.CanonicalName(origin)}
+	if err := p.parse(r, 0); err != nil {
+		return nil, err
+	}
+	return p.records, nil
+}
+
+// parse reads the entries of r, following $INCLUDE directives up to maxIncludeDepth levels deep.
+func (p *parser) parse(r io.Reader, depth int) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	entries, err := splitEntries(string(content))
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.filename, err)
+	}
+
+	for _, e := range entries {
+		if err := p.parseEntry(e, depth); err != nil {
+			return fmt.Errorf("%s:%d: %w", p.filename, e.line, err)
+		}
+	}
+	return nil
+}
+
+// parseEntry handles a single directive or record.
+func (p *parser) parseEntry(e entry, depth int) error {
+	first := e.tokens[0]
+	if !e.blankOwner && !first.quoted && strings.HasPrefix(first.text, "$") {
+		return p.parseDirective(strings.ToUpper(first.text), e.tokens[1:], depth)
+	}
+
+	tokens := e.tokens
+	owner := p.lastOwner
+	if !e.blankOwner {
+		var err error
+		if owner, err = dns.QualifyName(first.text, p.origin); err != nil {
+			return err
+		}
+		tokens = tokens[1:]
+	}
+	if e.blankOwner && !p.hasOwner {
+		return fmt.Errorf("record without an owner name")
+	}
+
+	// The TTL and the class may appear in any order before the type
+	ttl, hasTTL := uint32(0), false
+	class := dns.ClassIN
+	rrType := dns.Type(0)
+	for rrType == 0 {
+		if len(tokens) == 0 {
+			return fmt.Errorf("record without a type")
+		}
+		field := tokens[0].text
+		tokens = tokens[1:]
+
+		if value, err := parseTTL(field); err == nil && !hasTTL {
+			ttl, hasTTL = value, true
+			continue
+		}
+		if value, err := dns.ParseClass(field); err == nil {
+			class = value
+			continue
+		}
+		value, err := dns.ParseType(field)
+		if err != nil {
+			return err
+		}
+		rrType = value
+	}
+
+	switch {
+	case hasTTL:
+		p.lastTTL, p.hasTTL = ttl, true
+	case p.defaultTTL > 0:
+		ttl = p.defaultTTL
+	case p.hasTTL:
+		ttl = p.lastTTL
+	default:
+		return fmt.Errorf("record without a TTL and no $TTL directive")
+	}
+
+	fields := make([]string, len(tokens))
+	for i, t := range tokens {
+		fields[i] = t.text
+		if i == 0 && t.quoted && t.text == `\#` {
+			// Only the unquoted form introduces generic record data (RFC 3597 section 5)
+			fields[i] = `\035`
+		}
+	}
+	rdata, err := dns.ParseRData(rrType, fields, p.origin)
+	if err != nil {
+		return err
+	}
+
+	p.lastOwner, p.hasOwner = owner, true
+	p.records = append(p.records, dns.Answer{Name: owner, Type: rrType, Class: class, TTL: ttl, RData: rdata})
+	return nil
+}
+
+// parseDirective handles $ORIGIN, $TTL and $INCLUDE.
+func (p *parser) parseDirective(name string, args []token, depth int) error {
+	switch name {
+	case "$ORIGIN":
+		if len(args) != 1 {
+			return fmt.Errorf("$ORIGIN expects one name")
+		}
+		origin, err := dns.QualifyName(args[0].text, p.origin)
+		if err != nil {
+			return err
+		}
+		p.origin = origin
+
+	case "$TTL":
+		if len(args) != 1 {
+			return fmt.Errorf("$TTL expects one TTL")
+		}
+		ttl, err := parseTTL(args[0].text)
+		if err != nil {
+			return err
+		}
+		p.defaultTTL = ttl
+
+	case "$INCLUDE":
+		if len(args) != 1 && len(args) != 2 {
+			return fmt.Errorf("$INCLUDE expects a file name and an optional origin")
+		}
+		if depth >= maxIncludeDepth {
+			return fmt.Errorf("$INCLUDE nested more than %d levels deep", maxIncludeDepth)
+		}
+		return p.include(args, depth)
+
+	default:
+		return fmt.Errorf("unknown directive %s", name)
+	}
+	return nil
+}
+
+// include parses another file. Its origin changes do not leak into the including file (RFC 1035 section 5.1).
+func (p *parser) include(args []token, depth int) error {
+	path, err := dns.Unescape(args[0].text)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(p.filename), path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			fmt.Println("Failed to close", path, ":", err)
+		}
+	}(file)
+
+	filename, origin := p.filename, p.origin
+	defer func() { p.filename, p.origin = filename, origin }()
+
+	p.filename = path
+	if len(args) == 2 {
+		if p.origin, err = dns.QualifyName(args[1].text, origin); err != nil {
+			return err
+		}
+	}
+	return p.parse(file, depth+1)
+}
+
+// splitEntries splits a master file into entries, joining lines inside parentheses
+// and dropping comments and empty lines.
+func splitEntries(content string) ([]entry, error) {
+	var entries []entry
+	var current entry
+	var field strings.Builder
+	inField, quoted, parens := false, false, 0
+	line := 1
+	atLineStart := true
+
+	endField := func() {
+		if inField || quoted {
+			current.tokens = append(current.tokens, token{text: field.String(), quoted: quoted})
+		}
+		field.Reset()
+		inField = false
+	}
+	endEntry := func() {
+		if len(current.tokens) > 0 {
+			entries = append(entries, current)
+		}
+		current = entry{}
+	}
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		if quoted {
+			switch c {
+			case '"':
+				endField()
+				quoted = false
+			case '\\':
+				// Keep the escape for dns.Unescape, but never let it end the string
+				field.WriteByte(c)
+				if i+1 < len(content) {
+					i++
+					field.WriteByte(content[i])
+				}
+			case '\n':
+				return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+			default:
+				field.WriteByte(c)
+			}
+			continue
+		}
+
+		if atLineStart {
+			current.line = line
+			current.blankOwner = c == ' ' || c == '\t'
+			atLineStart = false
+		}
+
+		switch {
+		case c == ';':
+			for i+1 < len(content) && content[i+1] != '\n' {
+				i++
+			}
+		case c == '"':
+			endField()
+			quoted = true
+		case c == '(':
+			endField()
+			parens++
+		case c == ')':
+			endField()
+			if parens == 0 {
+				return nil, fmt.Errorf("line %d: unbalanced ')'", line)
+			}
+			parens--
+		case c == '\n':
+			endField()
+			line++
+			if parens == 0 {
+				endEntry()
+				atLineStart = true
+			}
+		case unicode.IsSpace(rune(c)):
+			endField()
+		case c == '\\' && i+1 < len(content):
+			// Keep escapes such as "\#" or "\." intact, an escaped space does not end the field
+			field.WriteByte(c)
+			i++
+			field.WriteByte(content[i])
+			inField = true
+		default:
+			field.WriteByte(c)
+			inField = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+	}
+	if parens > 0 {
+		return nil, fmt.Errorf("line %d: unbalanced '('", line)
+	}
+	endField()
+	endEntry()
+	return entries, nil
+}
+
+// parseTTL parses a TTL given in seconds, such as "3600", or with units, such as "1h30m" or "2W".
+// The units are s, m, h, d and w in either case.
+func parseTTL(field string) (uint32, error) {
+	if value, err := strconv.ParseUint(field, 10, 32); err == nil {
+		return uint32(value), nil
+	}
+	if field == "" || field[0] < '0' || field[0] > '9' {
+		return 0, fmt.Errorf("invalid TTL '%s'", field)
+	}
+
+	units := map[byte]uint64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	var total, number uint64
+	digits := false
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c >= '0' && c <= '9' {
+			number = number*10 + uint64(c-'0')
+			digits = true
+			if number > 0xFFFFFFFF {
+				return 0, fmt.Errorf("invalid TTL '%s'", field)
+			}
+			continue
+		}
+
+		unit, ok := units[byte(unicode.ToLower(rune(c)))]
+		if !ok || !digits {
+			return 0, fmt.Errorf("invalid TTL '%s'", field)
+		}
+		total += number * unit
+		number, digits = 0, false
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid TTL '%s'", field)
+	}
+	if total > 0xFFFFFFFF {
+		return 0, fmt.Errorf("TTL '%s' exceeds 32 bits", field)
+	}
+	return uint32(total), nil
+}
@@ -0,0 +1,191 @@
+package zone
+
+import (
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseString parses a master file given as a string with the origin example.com.
+func parseString(t *testing.T, content string) []dns.Answer {
+	t.Helper()
+
+	records, err := Parse(strings.NewReader(content), "test.zone", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// writeFile writes a master file into dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRecords(t *testing.T) {
+	records := parseString(t, `
+$TTL 1h
+@	IN	SOA	ns1 hostmaster (
+		2024010101 ; serial
+		7200 3600 1209600 300 )
+	NS	ns1.example.com.
+ns1	300 IN A 192.0.2.1
+	IN 600 AAAA 2001:db8::1
+mail	MX	10 ns1
+`)
+
+	want := []struct {
+		name   string
+		rrType dns.Type
+		ttl    uint32
+		data   string
+	}{
+		{"example.com", dns.TypeSOA, 3600, "ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300"},
+		{"example.com", dns.TypeNS, 3600, "ns1.example.com."},
+		{"ns1.example.com", dns.TypeA, 300, "192.0.2.1"},
+		{"ns1.example.com", dns.TypeAAAA, 600, "2001:db8::1"},
+		{"mail.example.com", dns.TypeMX, 3600, "10 ns1.example.com."},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, expected %d", len(records), len(want))
+	}
+	for i, record := range records {
+		if record.Name != want[i].name || record.Type != want[i].rrType || record.TTL != want[i].ttl || record.RData.String() != want[i].data {
+			t.Errorf("record %d is %s %s %d %s, expected %+v", i, record.Name, record.Type, record.TTL, record.RData, want[i])
+		}
+	}
+}
+
+func TestParseEscapes(t *testing.T) {
+	records := parseString(t, `
+$TTL 300
+quoted	TXT	"\065bc" "say \"hi\"" "back\\slash" "\#"
+plain	TXT	\065bc a\ b
+a\032b	A	192.0.2.1
+\097bs.	A	192.0.2.3
+`)
+
+	wantTexts := [][]string{{"Abc", `say "hi"`, `back\slash`, "#"}, {"Abc", "a b"}}
+	for i, want := range wantTexts {
+		got := records[i].RData.(*dns.TXT).Text
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("TXT record %d has strings %q, expected %q", i, got, want)
+		}
+	}
+
+	wantNames := []string{"a b.example.com", "abs"}
+	for i, want := range wantNames {
+		if got := records[len(wantTexts)+i].Name; got != want {
+			t.Errorf("owner %d is '%s', expected '%s'", i, got, want)
+		}
+	}
+
+	// A dot inside a label would silently become a label separator
+	for _, content := range []string{
+		"$TTL 300\na\\.b A 192.0.2.1\n",
+		"$TTL 300\na\\046b A 192.0.2.1\n",
+		"$TTL 300\nalias CNAME a\\.b.example.com.\n",
+		"$ORIGIN a\\.b.\n",
+	} {
+		if records, err := Parse(strings.NewReader(content), "test.zone", "example.com"); err == nil {
+			t.Errorf("parsing %q gave %d records, expected an error for the escaped dot", content, len(records))
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"escape above 255":     "$TTL 300\nbad TXT \"\\999\"\n",
+		"short escape":         "$TTL 300\nbad TXT \\06\n",
+		"escaped owner":        "$TTL 300\nbad\\256 A 192.0.2.1\n",
+		"unterminated string":  "$TTL 300\nbad TXT \"open\n",
+		"unbalanced paren":     "$TTL 300\nbad TXT ( \"a\"\n",
+		"missing TTL":          "bad A 192.0.2.1\n",
+		"blank owner first":    "$TTL 300\n A 192.0.2.1\n",
+		"unknown directive":    "$FOO bar\n",
+		"invalid record data":  "$TTL 300\nbad A 2001:db8::1\n",
+		"unknown record type":  "$TTL 300\nbad BOGUS 1\n",
+		"invalid generic data": "$TTL 300\nbad TYPE999 \\# 2 00\n",
+	}
+
+	for description, content := range tests {
+		if _, err := Parse(strings.NewReader(content), "test.zone", "example.com"); err == nil {
+			t.Errorf("%s: expected an error", description)
+		}
+	}
+}
+
+func TestParseOriginAndInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "hosts.zone", `
+$ORIGIN hosts.example.com.
+www	A	192.0.2.1
+`)
+	writeFile(t, dir, "mail.zone", `
+@	A	192.0.2.2
+smtp	A	192.0.2.3
+`)
+	main := writeFile(t, dir, "main.zone", `
+$TTL 300
+before	A	192.0.2.10
+$INCLUDE hosts.zone
+after	A	192.0.2.11
+$INCLUDE "mail.zone" mail
+$ORIGIN other.test.
+last	A	192.0.2.12
+	A	192.0.2.13
+`)
+
+	file, err := os.Open(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records, err := Parse(file, main, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The origin set by an included file, or given with $INCLUDE, ends with the file
+	want := []string{
+		"before.example.com",
+		"www.hosts.example.com",
+		"after.example.com",
+		"mail.example.com",
+		"smtp.mail.example.com",
+		"last.other.test",
+		"last.other.test",
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, expected %d", len(records), len(want))
+	}
+	for i, record := range records {
+		if record.Name != want[i] {
+			t.Errorf("record %d is owned by '%s', expected '%s'", i, record.Name, want[i])
+		}
+	}
+}
+
+func TestParseIncludeLoop(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "loop.zone", "$INCLUDE loop.zone\n")
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := Parse(file, path, "example.com"); err == nil {
+		t.Error("expected an error for a file including itself")
+	}
+}
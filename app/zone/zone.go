@@ -0,0 +1,312 @@
+package zone
+
+import (
+	"fmt"
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"os"
+	"strings"
+)
+
+// maxCNAMEChain limits how many CNAME records of the zone are followed for a single answer.
+const maxCNAMEChain = 8
+
+// Zone holds the records of a zone and answers queries for it with authority.
+//
+// Answers carry the AA bit. Names without records are answered with NXDOMAIN, names without
+// records of the asked type with NODATA, both with the SOA in the authority section. Names at or
+// below a delegation cut get a referral to the name servers of the child zone together with their
+// glue. Names matching a wildcard are answered with the records of the wildcard (RFC 4592), and
+// CNAME records are followed inside the zone.
+type Zone struct {
+	// Origin is the apex of the zone in canonical form, see dns.CanonicalName.
+	Origin string
+
+	soa   dns.Answer
+	nodes map[string]map[dns.Type][]dns.Answer
+
+	// exists holds every name owning records and every name above them up to the apex,
+	// so empty non-terminals are answered with NODATA instead of NXDOMAIN.
+	exists map[string]bool
+}
+
+// New builds a zone from its records. The apex of the zone is the owner of its only SOA record.
+//
+// Parameters:
+// - records: The records of the zone, all of class IN and located at or below the apex.
+//
+// Returns:
+// - A pointer to the Zone.
+// - An error if the zone has no SOA or more than one, a record lies outside the zone, or a SOA or CNAME
+// record lacks its typed record data.
+func New(records []dns.Answer) (*Zone, error) {
+	z := &Zone{
+		nodes:  make(map[string]map[dns.Type][]dns.Answer),
+		exists: make(map[string]bool),
+	}
+
+	soaCount := 0
+	for _, record := range records {
+		// The answers rely on the typed data of these records
+		_, isSOA := record.RData.(*dns.SOA)
+		_, isCNAME := record.RData.(*dns.CNAME)
+		if record.Type == dns.TypeSOA && !isSOA || record.Type == dns.TypeCNAME && !isCNAME {
+			return nil, fmt.Errorf("record %s %s has no valid record data", record.Name, record.Type)
+		}
+
+		if record.Type == dns.TypeSOA {
+			z.soa = record
+			z.Origin = dns.CanonicalName(record.Name)
+			soaCount++
+		}
+	}
+	if soaCount != 1 {
+		return nil, fmt.Errorf("zone must have exactly one SOA record, found %d", soaCount)
+	}
+
+	for _, record := range records {
+		name := dns.CanonicalName(record.Name)
+		if !dns.IsSubDomain(z.Origin, name) {
+			return nil, fmt.Errorf("record %s %s is outside of zone '%s'", record.Name, record.Type, z.Origin)
+		}
+		if record.Class != dns.ClassIN {
+			return nil, fmt.Errorf("record %s %s has class %s, only IN is supported", record.Name, record.Type, record.Class)
+		}
+
+		if z.nodes[name] == nil {
+			z.nodes[name] = make(map[dns.Type][]dns.Answer)
+		}
+		z.nodes[name][record.Type] = append(z.nodes[name][record.Type], record)
+
+		for ancestor := name; !z.exists[ancestor]; ancestor = parent(ancestor) {
+			z.exists[ancestor] = true
+			if ancestor == z.Origin {
+				break
+			}
+		}
+	}
+
+	for name, node := range z.nodes {
+		if _, ok := node[dns.TypeCNAME]; ok && len(node) > 1 {
+			return nil, fmt.Errorf("'%s' has a CNAME record and other records", name)
+		}
+	}
+	return z, nil
+}
+
+// Load parses the master file at path and builds a zone from it, see Parse and New.
+//
+// Parameters:
+// - path: The path of the master file.
+// - origin: The initial origin of the file, "" if the file only uses absolute names or sets $ORIGIN.
+//
+// Returns:
+// - A pointer to the Zone.
+// - An error if the file cannot be read or does not describe a valid zone.
+func Load(path, origin string) (*Zone, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			fmt.Println("Failed to close", path, ":", err)
+		}
+	}(file)
+
+	records, err := Parse(file, path, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	z, err := New(records)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return z, nil
+}
+
+// Contains reports whether name lies at or below the apex of the zone.
+func (z *Zone) Contains(name string) bool {
+	return dns.IsSubDomain(z.Origin, name)
+}
+
+// ServeDNS answers the query from the records of the zone.
+func (z *Zone) ServeDNS(w dns.ResponseWriter, r *dns.Message) {
+	if err := w.WriteMsg(z.Answer(r)); err != nil {
+		fmt.Println("Failed to send response:", err)
+	}
+}
+
+// Answer builds the response of the zone to the query.
+// Queries for names outside the zone, of another class than IN, or not carrying exactly one question are refused.
+//
+// Parameters:
+// - query: The query to answer.
+//
+// Returns:
+// - A pointer to the response.
+func (z *Zone) Answer(query *dns.Message) *dns.Message {
+	response := dns.NewResponse(query)
+	if len(query.Questions) != 1 {
+		response.SetRCode(dns.RCodeFormatError)
+		return response
+	}
+
+	question := query.Questions[0]
+	if !z.Contains(question.Name) || (question.Class != dns.ClassIN && question.Class != dns.ClassANY) {
+		response.SetRCode(dns.RCodeRefused)
+		return response
+	}
+
+	z.answer(response, question.Name, question.Type)
+	z.addAdditional(response)
+	return response
+}
+
+// answer fills the response for name, following CNAME records inside the zone.
+func (z *Zone) answer(response *dns.Message, name string, qtype dns.Type) {
+	for chain := 0; chain <= maxCNAMEChain; chain++ {
+		canonical := dns.CanonicalName(name)
+
+		if cut := z.delegation(canonical); cut != "" {
+			z.refer(response, cut)
+			return
+		}
+		response.Header.AA = true
+
+		node, owner := z.nodes[canonical], name
+		if node == nil && !z.exists[canonical] {
+			node = z.wildcard(canonical)
+		}
+		if node == nil {
+			if !z.exists[canonical] {
+				response.Header.RCode = dns.RCodeNameError
+			}
+			z.addSOA(response)
+			return
+		}
+
+		if records := matching(node, qtype); len(records) > 0 {
+			response.Answers = append(response.Answers, withOwner(records, owner)...)
+			return
+		}
+
+		cname, ok := node[dns.TypeCNAME]
+		if !ok {
+			// NODATA, the name exists without records of the type
+			z.addSOA(response)
+			return
+		}
+		response.Answers = append(response.Answers, withOwner(cname, owner)...)
+
+		name = cname[0].RData.(*dns.CNAME).Target
+		if !z.Contains(name) {
+			// The resolver of the client continues outside of the zone
+			return
+		}
+	}
+}
+
+// delegation returns the closest delegation cut at or above name and below the apex, or "" if there is none.
+func (z *Zone) delegation(name string) string {
+	cut := ""
+	for ancestor := name; ancestor != z.Origin; ancestor = parent(ancestor) {
+		if _, ok := z.nodes[ancestor][dns.TypeNS]; ok {
+			cut = ancestor
+		}
+	}
+	return cut
+}
+
+// refer turns the response into a referral to the name servers of the child zone at cut.
+// The response is not authoritative; the glue of name servers inside the zone goes into the additional section.
+func (z *Zone) refer(response *dns.Message, cut string) {
+	response.Header.AA = false
+	response.Authority = append(response.Authority, z.nodes[cut][dns.TypeNS]...)
+}
+
+// wildcard returns the records of the wildcard matching name, or nil if no wildcard applies.
+// The wildcard is the "*" child of the closest encloser, the longest existing ancestor of name.
+func (z *Zone) wildcard(name string) map[dns.Type][]dns.Answer {
+	encloser := name
+	for encloser != z.Origin && !z.exists[encloser] {
+		encloser = parent(encloser)
+	}
+
+	wildcard := "*"
+	if encloser != "" {
+		wildcard += "." + encloser
+	}
+	return z.nodes[wildcard]
+}
+
+// addSOA adds the SOA of the zone to the authority section of a negative response.
+// Its TTL is the smaller of its own TTL and its minimum field, as RFC 2308 section 3 requires.
+func (z *Zone) addSOA(response *dns.Message) {
+	soa := z.soa
+	if minimum := soa.RData.(*dns.SOA).Minimum; minimum < soa.TTL {
+		soa.TTL = minimum
+	}
+	response.Authority = append(response.Authority, soa)
+}
+
+// addAdditional adds the addresses of the hosts named by NS, MX and SRV records of the answer
+// and authority sections, as long as the zone holds them. For referrals these are the glue records.
+func (z *Zone) addAdditional(response *dns.Message) {
+	seen := make(map[string]bool)
+	for _, record := range append(append([]dns.Answer(nil), response.Answers...), response.Authority...) {
+		var host string
+		switch rdata := record.RData.(type) {
+		case *dns.NS:
+			host = rdata.Host
+		case *dns.MX:
+			host = rdata.Exchange
+		case *dns.SRV:
+			host = rdata.Target
+		default:
+			continue
+		}
+
+		host = dns.CanonicalName(host)
+		if seen[host] || !z.Contains(host) {
+			continue
+		}
+		seen[host] = true
+
+		node := z.nodes[host]
+		response.Additional = append(response.Additional, node[dns.TypeA]...)
+		response.Additional = append(response.Additional, node[dns.TypeAAAA]...)
+	}
+}
+
+// matching returns the records of the node answering the type, every record for ANY queries.
+func matching(node map[dns.Type][]dns.Answer, qtype dns.Type) []dns.Answer {
+	if qtype != dns.TypeANY {
+		return node[qtype]
+	}
+
+	var records []dns.Answer
+	for _, rrset := range node {
+		records = append(records, rrset...)
+	}
+	return records
+}
+
+// withOwner copies the records with their owner set to name, which synthesizes wildcard answers.
+func withOwner(records []dns.Answer, name string) []dns.Answer {
+	copied := make([]dns.Answer, len(records))
+	for i, record := range records {
+		record.Name = name
+		copied[i] = record
+	}
+	return copied
+}
+
+// parent returns the name with its first label removed, "" for a top level name.
+func parent(name string) string {
+	if dot := strings.IndexByte(name, '.'); dot >= 0 {
+		return name[dot+1:]
+	}
+	return ""
+}
@@ -0,0 +1,170 @@
+package zone
+
+import (
+	"github.com/codecrafters-io/dns-server-starter-go/app/dns"
+	"strings"
+	"testing"
+)
+
+const testZone = `
+$ORIGIN example.com.
+$TTL 3600
+@	SOA	ns1 hostmaster 1 7200 3600 1209600 300
+@	NS	ns1
+ns1	A	192.0.2.1
+www	A	192.0.2.2
+alias	CNAME	www
+away	CNAME	www.example.org.
+a.b.c	A	192.0.2.3
+*.wild	A	192.0.2.4
+mail	MX	10 ns1
+sub	NS	ns.sub
+ns.sub	A	192.0.2.5
+`
+
+func newTestZone(t *testing.T) *Zone {
+	t.Helper()
+
+	records, err := Parse(strings.NewReader(testZone), "test.zone", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := New(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+func ask(z *Zone, name string, rrType dns.Type) *dns.Message {
+	return z.Answer(&dns.Message{
+		Header:    dns.Header{ID: 1},
+		Questions: []dns.Question{{Name: name, Type: rrType, Class: dns.ClassIN}},
+	})
+}
+
+// section formats the records of a section as "name type data" lines.
+func section(records []dns.Answer) []string {
+	lines := make([]string, len(records))
+	for i, record := range records {
+		lines[i] = dns.CanonicalName(record.Name) + " " + record.Type.String() + " " + record.RData.String()
+	}
+	return lines
+}
+
+func TestZoneAnswers(t *testing.T) {
+	z := newTestZone(t)
+
+	tests := []struct {
+		description string
+		name        string
+		rrType      dns.Type
+		answers     []string
+		additional  []string
+	}{
+		{"records of the name", "www.example.com", dns.TypeA, []string{"www.example.com A 192.0.2.2"}, nil},
+		{"case insensitive", "WWW.Example.COM", dns.TypeA, []string{"www.example.com A 192.0.2.2"}, nil},
+		{"CNAME inside the zone", "alias.example.com", dns.TypeA,
+			[]string{"alias.example.com CNAME www.example.com.", "www.example.com A 192.0.2.2"}, nil},
+		{"CNAME leaving the zone", "away.example.com", dns.TypeA, []string{"away.example.com CNAME www.example.org."}, nil},
+		{"wildcard", "host.wild.example.com", dns.TypeA, []string{"host.wild.example.com A 192.0.2.4"}, nil},
+		{"wildcard below a missing name", "a.host.wild.example.com", dns.TypeA, []string{"a.host.wild.example.com A 192.0.2.4"}, nil},
+		{"additional addresses", "mail.example.com", dns.TypeMX, []string{"mail.example.com MX 10 ns1.example.com."},
+			[]string{"ns1.example.com A 192.0.2.1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			response := ask(z, test.name, test.rrType)
+			if !response.Header.AA || response.Header.RCode != dns.RCodeSuccess {
+				t.Errorf("got AA %t and rcode %d, expected an authoritative answer", response.Header.AA, response.Header.RCode)
+			}
+			if got := section(response.Answers); strings.Join(got, "\n") != strings.Join(test.answers, "\n") {
+				t.Errorf("got answers %q, expected %q", got, test.answers)
+			}
+			if got := section(response.Additional); strings.Join(got, "\n") != strings.Join(test.additional, "\n") {
+				t.Errorf("got additional records %q, expected %q", got, test.additional)
+			}
+		})
+	}
+}
+
+func TestZoneNegativeAnswers(t *testing.T) {
+	z := newTestZone(t)
+
+	tests := []struct {
+		description string
+		name        string
+		rrType      dns.Type
+		rcode       uint8
+	}{
+		{"NXDOMAIN", "missing.example.com", dns.TypeA, dns.RCodeNameError},
+		{"NXDOMAIN below an existing name", "below.www.example.com", dns.TypeA, dns.RCodeNameError},
+		{"NODATA", "www.example.com", dns.TypeAAAA, dns.RCodeSuccess},
+		{"empty non-terminal", "b.c.example.com", dns.TypeA, dns.RCodeSuccess},
+		{"empty non-terminal above a wildcard", "wild.example.com", dns.TypeA, dns.RCodeSuccess},
+		{"NODATA at a wildcard", "host.wild.example.com", dns.TypeTXT, dns.RCodeSuccess},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			response := ask(z, test.name, test.rrType)
+			if !response.Header.AA || response.Header.RCode != test.rcode {
+				t.Errorf("got AA %t and rcode %d, expected an authoritative rcode %d", response.Header.AA, response.Header.RCode, test.rcode)
+			}
+			if len(response.Answers) != 0 {
+				t.Errorf("got answers %q, expected none", section(response.Answers))
+			}
+			if len(response.Authority) != 1 || response.Authority[0].Type != dns.TypeSOA {
+				t.Fatalf("got authority %q, expected the SOA", section(response.Authority))
+			}
+			if ttl := response.Authority[0].TTL; ttl != 300 {
+				t.Errorf("SOA has TTL %d, expected the minimum 300", ttl)
+			}
+		})
+	}
+}
+
+func TestZoneReferral(t *testing.T) {
+	for _, name := range []string{"sub.example.com", "host.sub.example.com"} {
+		response := ask(newTestZone(t), name, dns.TypeA)
+
+		if response.Header.AA || response.Header.RCode != dns.RCodeSuccess || len(response.Answers) != 0 {
+			t.Errorf("%s: got AA %t, rcode %d and answers %q, expected a referral", name, response.Header.AA, response.Header.RCode, section(response.Answers))
+		}
+		if got := section(response.Authority); len(got) != 1 || got[0] != "sub.example.com NS ns.sub.example.com." {
+			t.Errorf("%s: got authority %q, expected the NS of sub.example.com", name, got)
+		}
+		if got := section(response.Additional); len(got) != 1 || got[0] != "ns.sub.example.com A 192.0.2.5" {
+			t.Errorf("%s: got additional records %q, expected the glue", name, got)
+		}
+	}
+}
+
+func TestZoneRefusesOtherZones(t *testing.T) {
+	if response := ask(newTestZone(t), "www.example.org", dns.TypeA); response.Header.RCode != dns.RCodeRefused {
+		t.Errorf("got rcode %d, expected REFUSED", response.Header.RCode)
+	}
+}
+
+func TestNewRejectsInvalidZones(t *testing.T) {
+	soa := dns.Answer{Name: "example.com", Type: dns.TypeSOA, Class: dns.ClassIN, TTL: 300,
+		RData: &dns.SOA{MName: "ns1.example.com", RName: "hostmaster.example.com"}}
+	www := dns.Answer{Name: "www.example.com", Type: dns.TypeA, Class: dns.ClassIN, TTL: 300, RData: &dns.A{IP: []byte{192, 0, 2, 1}}}
+	cname := dns.Answer{Name: "www.example.com", Type: dns.TypeCNAME, Class: dns.ClassIN, TTL: 300, RData: &dns.CNAME{Target: "example.com"}}
+
+	tests := map[string][]dns.Answer{
+		"no SOA":           {www},
+		"two SOA":          {soa, soa},
+		"outside the zone": {soa, {Name: "www.example.org", Type: dns.TypeA, Class: dns.ClassIN, RData: www.RData}},
+		"CNAME and data":   {soa, www, cname},
+		"SOA without data": {{Name: "example.com", Type: dns.TypeSOA, Class: dns.ClassIN}},
+		"raw CNAME data":   {soa, {Name: "x.example.com", Type: dns.TypeCNAME, Class: dns.ClassIN, RData: &dns.RawRData{RRType: dns.TypeCNAME}}},
+	}
+
+	for description, records := range tests {
+		if _, err := New(records); err == nil {
+			t.Errorf("%s: expected an error", description)
+		}
+	}
+}